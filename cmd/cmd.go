@@ -16,28 +16,69 @@ func SetUp() cli.Command {
 		Usage:       "Monitoring tool for node I/O",
 		Description: "iotop command launches a view for topology nodes",
 		Action:      iotop.Run,
+		Subcommands: []cli.Command{SetUpExport()},
 	}
 	cmd.Flags = CmdFlags
 	return cmd
 }
 
+// SetUpExport sets up export sub command, which serves node I/O as
+// Prometheus metrics.
+func SetUpExport() cli.Command {
+	cmd := cli.Command{
+		Name:        "export",
+		Usage:       "Prometheus exporter for node I/O",
+		Description: "export command serves node I/O of the topology on /metrics",
+		Action:      iotop.RunExport,
+	}
+	cmd.Flags = ExportCmdFlags
+	return cmd
+}
+
+var (
+	uriFlag = cli.StringFlag{
+		Name:   "uri",
+		Value:  fmt.Sprintf("http://localhost:%d/", config.DefaultPort),
+		Usage:  "the address of the target SensorBee server",
+		EnvVar: "SENSORBEE_URI",
+	}
+	apiVersionFlag = cli.StringFlag{
+		Name:  "api-version",
+		Value: "v1",
+		Usage: "target API version",
+	}
+	topologyFlag = cli.StringFlag{
+		Name:  "topology,t",
+		Usage: "the SensorBee topology to use",
+	}
+	gcSourcesFlag = cli.BoolFlag{
+		Name:  "gc-sources",
+		Usage: "drop node_statuses sources left by dead iotop sessions on this host",
+	}
+)
+
 // CmdFlags is list of command options.
 var CmdFlags = []cli.Flag{
 	cli.StringFlag{
 		Name:   "uri",
 		Value:  fmt.Sprintf("http://localhost:%d/", config.DefaultPort),
-		Usage:  "the address of the target SensorBee server",
+		Usage:  "the addresses of the target SensorBee servers, separated by commas",
 		EnvVar: "SENSORBEE_URI",
 	},
 	cli.StringFlag{
-		Name:  "api-version",
-		Value: "v1",
-		Usage: "target API version",
+		Name:  "uri-file",
+		Usage: "the file listing addresses of the target SensorBee servers, one per line",
 	},
+	apiVersionFlag,
 	cli.StringFlag{
 		Name:  "topology,t",
-		Usage: "the SensorBee topology to use",
+		Usage: "the SensorBee topologies to monitor, separated by commas",
+	},
+	cli.BoolFlag{
+		Name:  "all",
+		Usage: "monitor all topologies on the servers",
 	},
+	gcSourcesFlag,
 	cli.Float64Flag{
 		Name:  "d",
 		Value: 5.,
@@ -52,4 +93,92 @@ var CmdFlags = []cli.Flag{
 		Name:  "c",
 		Usage: "show in/out count in absolute value or not",
 	},
+	cli.StringFlag{
+		Name:  "sort",
+		Value: "name",
+		Usage: "column to sort, \"name\", \"rate\", \"dropped\", \"errors\" or \"queue\"",
+	},
+	cli.BoolFlag{
+		Name:  "sort-reverse",
+		Usage: "reverse the sort order, name is ascending and others are descending by default",
+	},
+	cli.StringFlag{
+		Name:  "filter",
+		Usage: "show only nodes matched by globs or /regexps/ separated by spaces, '!' excludes matched nodes",
+	},
+	cli.BoolFlag{
+		Name:  "events",
+		Usage: "show the latest events of nodes and edges at the bottom, 'e' key toggles them",
+	},
+	cli.BoolFlag{
+		Name:  "smoothed",
+		Usage: "show moving averages and EWMAs of rates, 's' key toggles them",
+	},
+	cli.StringFlag{
+		Name:  "smooth-windows",
+		Value: "1m,5m,15m",
+		Usage: "windows of exponentially weighted moving averages of rates",
+	},
+	cli.Float64Flag{
+		Name:  "queue-warn",
+		Value: 50.,
+		Usage: "highlight edges in yellow when a queue is filled over this [%]",
+	},
+	cli.Float64Flag{
+		Name:  "queue-crit",
+		Value: 90.,
+		Usage: "highlight edges in red when a queue is filled over this [%]",
+	},
+	cli.BoolFlag{
+		Name:  "no-color",
+		Usage: "disable highlighting lines in colors",
+	},
+	cli.StringFlag{
+		Name:  "alert-rules",
+		Usage: "file of alert rules to run commands, write logs, ring the bell or exit in batch mode",
+	},
+	cli.BoolFlag{
+		Name:  "batch,b",
+		Usage: "run in batch mode, write snapshots to stdout without terminal UI",
+	},
+	cli.IntFlag{
+		Name:  "n",
+		Value: 0,
+		Usage: "number of iterations in batch mode, 0 means unlimited, 1 by default on DOT output",
+	},
+	cli.StringFlag{
+		Name:  "output,o",
+		Value: "text",
+		Usage: "output format, \"text\", \"json\", \"csv\" or \"dot\", except \"text\" runs in batch mode",
+	},
+	cli.StringFlag{
+		Name:  "csv-dir",
+		Usage: "directory to append CSV files for each node type, implies \"--output csv\"",
+	},
+	cli.StringFlag{
+		Name:  "record",
+		Usage: "file to record node statuses in gzip compressed JSON lines",
+	},
+	cli.StringFlag{
+		Name:  "replay",
+		Usage: "file recorded by --record to replay without servers",
+	},
+	cli.Float64Flag{
+		Name:  "replay-speed",
+		Value: 1.,
+		Usage: "speed of replay, 2 replays twice as fast as recorded",
+	},
+}
+
+// ExportCmdFlags is list of export command options.
+var ExportCmdFlags = []cli.Flag{
+	uriFlag,
+	apiVersionFlag,
+	topologyFlag,
+	gcSourcesFlag,
+	cli.StringFlag{
+		Name:  "listen",
+		Value: ":9601",
+		Usage: "the address to serve Prometheus metrics",
+	},
 }
@@ -0,0 +1,570 @@
+package iotop
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// alertExitCode is the exit status of batch mode when an alert with "exit"
+// action fires.
+const alertExitCode = 2
+
+// alertRule is a condition on nodes or edges, and actions taken when the
+// condition holds for the duration. A rule is written in a line like:
+//
+//	box filter_* drop_rate > 10 for 30s then exec "notify.sh" log alerts.log
+//	sink output state != running then bell exit
+//
+// The first field is the kind of targets, "source", "box", "sink", "node"
+// or "edge", and the second one is a name pattern same as the filter. An edge
+// is matched when either the sender or the receiver is matched.
+type alertRule struct {
+	text     string
+	kind     string
+	match    func(string) bool
+	metric   string
+	op       string
+	value    float64
+	state    string // the value compared with "state" metric
+	duration time.Duration
+
+	command string // a shell command to run, or empty
+	logFile string // a file to append alerts to, or empty
+	bell    bool
+	exit    bool
+}
+
+// metrics available for each kind of targets, rates are per second and the
+// queue is the fill [%] of the larger one of the sender and the receiver.
+var alertMetrics = map[string][]string{
+	"source": {"out_rate", "drop_rate", "dropped", "state"},
+	"box": {"in_rate", "out_rate", "drop_rate", "error_rate", "dropped",
+		"errors", "state"},
+	"sink": {"in_rate", "error_rate", "errors", "state"},
+	"node": {"in_rate", "out_rate", "drop_rate", "error_rate", "dropped",
+		"errors", "state"},
+	"edge": {"queue"},
+}
+
+// parseAlertRule parses a line of the rule file.
+func parseAlertRule(line string) (*alertRule, error) {
+	fields, err := splitRuleFields(line)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) < 5 {
+		return nil, fmt.Errorf("a rule must be '<kind> <name> <metric> <op> <value>'")
+	}
+	r := &alertRule{
+		text:   strings.TrimSpace(line),
+		kind:   fields[0],
+		metric: fields[2],
+		op:     fields[3],
+	}
+	metrics, ok := alertMetrics[r.kind]
+	if !ok {
+		return nil, fmt.Errorf("invalid kind ('%v'), must be source, box, sink, node or edge",
+			r.kind)
+	}
+	if r.match, err = parseNamePattern(fields[1]); err != nil {
+		return nil, err
+	}
+	if !containsString(metrics, r.metric) {
+		return nil, fmt.Errorf("invalid metric ('%v') of %v, must be one of %v",
+			r.metric, r.kind, strings.Join(metrics, ", "))
+	}
+	switch r.op {
+	case "==", "!=":
+	case ">", ">=", "<", "<=":
+		if r.metric == "state" {
+			return nil, fmt.Errorf("state can only be compared by == or !=")
+		}
+	default:
+		return nil, fmt.Errorf("invalid operator ('%v')", r.op)
+	}
+	if r.metric == "state" {
+		r.state = fields[4]
+	} else {
+		v := strings.TrimSuffix(strings.TrimSuffix(fields[4], "/s"), "%")
+		if r.value, err = strconv.ParseFloat(v, 64); err != nil {
+			return nil, fmt.Errorf("invalid value ('%v')", fields[4])
+		}
+	}
+
+	rest := fields[5:]
+	if len(rest) >= 2 && rest[0] == "for" {
+		if r.duration, err = time.ParseDuration(rest[1]); err != nil {
+			return nil, fmt.Errorf("invalid duration ('%v')", rest[1])
+		}
+		rest = rest[2:]
+	}
+	if len(rest) == 0 {
+		return r, nil
+	}
+	if rest[0] != "then" {
+		return nil, fmt.Errorf("unexpected '%v', actions must follow 'then'", rest[0])
+	}
+	rest = rest[1:]
+	for len(rest) > 0 {
+		switch rest[0] {
+		case "exec", "log":
+			if len(rest) < 2 {
+				return nil, fmt.Errorf("'%v' needs an argument", rest[0])
+			}
+			if rest[0] == "exec" {
+				r.command = rest[1]
+			} else {
+				r.logFile = rest[1]
+			}
+			rest = rest[2:]
+		case "bell":
+			r.bell = true
+			rest = rest[1:]
+		case "exit":
+			r.exit = true
+			rest = rest[1:]
+		default:
+			return nil, fmt.Errorf("invalid action ('%v'), must be exec, log, bell or exit",
+				rest[0])
+		}
+	}
+	return r, nil
+}
+
+// splitRuleFields splits the line by spaces, and unquotes fields enclosed in
+// double quotes, which can contain spaces.
+func splitRuleFields(line string) ([]string, error) {
+	fields := []string{}
+	s := strings.TrimSpace(line)
+	for s != "" {
+		if s[0] != '"' {
+			i := strings.IndexAny(s, " \t")
+			if i < 0 {
+				i = len(s)
+			}
+			fields = append(fields, s[:i])
+			s = strings.TrimSpace(s[i:])
+			continue
+		}
+		end := -1
+		for i := 1; i < len(s); i++ {
+			if s[i] == '\\' {
+				i++
+			} else if s[i] == '"' {
+				end = i
+				break
+			}
+		}
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated quote")
+		}
+		f, err := strconv.Unquote(s[:end+1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid quoted string %v, %v", s[:end+1], err)
+		}
+		fields = append(fields, f)
+		s = strings.TrimSpace(s[end+1:])
+	}
+	return fields, nil
+}
+
+func containsString(l []string, s string) bool {
+	for _, e := range l {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// compare returns true when the condition of the rule holds for the value.
+func (r *alertRule) compare(v float64, state string) bool {
+	if r.metric == "state" {
+		return (state == r.state) == (r.op == "==")
+	}
+	switch r.op {
+	case ">":
+		return v > r.value
+	case ">=":
+		return v >= r.value
+	case "<":
+		return v < r.value
+	case "<=":
+		return v <= r.value
+	case "==":
+		return v == r.value
+	default:
+		return v != r.value
+	}
+}
+
+// alertState is the state of a rule on a target.
+type alertState struct {
+	rule  *alertRule
+	lh    *lineHolder // statuses of the target
+	since time.Time   // "ts" of statuses when the condition began to hold
+	fired bool
+	msg   string
+}
+
+// alerter evaluates alert rules on node statuses, and takes actions of fired
+// alerts.
+type alerter struct {
+	rules  []*alertRule
+	states map[string]*alertState
+	logs   map[string]*os.File
+	cmds   sync.WaitGroup
+
+	// "ts" of the last complete statuses of each holder checked for removed
+	// targets
+	checked map[*lineHolder]time.Time
+
+	exitMsg string // the message of the alert to exit batch mode, or empty
+	err     error  // the last failure of actions
+}
+
+// loadAlertRules reads rules from the file, which has a rule on each line.
+// Blank lines and lines starting with '#' are ignored. Log files of rules are
+// opened to append alerts.
+func loadAlertRules(fn string) (*alerter, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	a := &alerter{
+		states:  map[string]*alertState{},
+		logs:    map[string]*os.File{},
+		checked: map[*lineHolder]time.Time{},
+	}
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		r, err := parseAlertRule(line)
+		if err != nil {
+			a.Close()
+			return nil, fmt.Errorf("%v:%d: %v", fn, n, err)
+		}
+		if r.logFile != "" && a.logs[r.logFile] == nil {
+			lf, err := os.OpenFile(r.logFile,
+				os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+			if err != nil {
+				a.Close()
+				return nil, err
+			}
+			a.logs[r.logFile] = lf
+		}
+		a.rules = append(a.rules, r)
+	}
+	if err := s.Err(); err != nil {
+		a.Close()
+		return nil, err
+	}
+	return a, nil
+}
+
+// evaluate rules on the current statuses. An alert fires once when the
+// condition holds for the duration of the rule, and is resolved when the
+// condition does not hold. Targets without their statuses or rates keep
+// their states, because statuses of the current "ts" may be pushed partly.
+// Alerts of targets are resolved as removed only when the targets are
+// missing from both the current and the last complete statuses, which is
+// checked once for each complete statuses. A nil alerter does nothing.
+func (a *alerter) evaluate(h *lineHolder) {
+	if a == nil {
+		return
+	}
+	h.rwm.RLock()
+	defer h.rwm.RUnlock()
+
+	cur := &prevLineHolder{srcs: h.srcs, boxes: h.boxes, sinks: h.sinks,
+		edges: h.edges}
+	targets := map[string]bool{}
+	for i, r := range a.rules {
+		for _, t := range cur.alertTargets(r) {
+			key := alertStateKey(i, h, t)
+			targets[key] = true
+			v, state, ok := h.alertMetric(r, t)
+			if !ok {
+				continue
+			}
+			s, ok := a.states[key]
+			if !r.compare(v, state) {
+				if ok && s.fired {
+					a.act(r, fmt.Sprintf("RESOLVED %v", s.msg), false)
+				}
+				delete(a.states, key)
+				continue
+			}
+			if !ok {
+				s = &alertState{rule: r, lh: h, since: h.current}
+				a.states[key] = s
+			}
+			if s.fired || h.current.Sub(s.since) < r.duration {
+				continue
+			}
+			s.fired = true
+			if r.metric == "state" {
+				s.msg = fmt.Sprintf("%v: %v is %v [%v]", t, r.metric, state, r.text)
+			} else {
+				s.msg = fmt.Sprintf("%v: %v is %.2f [%v]", t, r.metric, v, r.text)
+			}
+			a.act(r, fmt.Sprintf("ALERT %v", s.msg), true)
+			if r.exit && a.exitMsg == "" {
+				a.exitMsg = s.msg
+			}
+		}
+	}
+
+	if h.last == nil || h.last.current.Equal(a.checked[h]) {
+		return
+	}
+	a.checked[h] = h.last.current
+	for i, r := range a.rules {
+		for _, t := range h.last.alertTargets(r) {
+			targets[alertStateKey(i, h, t)] = true
+		}
+	}
+	a.resolveRemoved(h, targets)
+}
+
+func alertStateKey(rule int, h *lineHolder, target string) string {
+	return fmt.Sprintf("%d|%s|%s|%s", rule, h.server, h.topology, target)
+}
+
+// forget resolves all alerts on targets in h, which is no longer evaluated.
+// A nil alerter does nothing.
+func (a *alerter) forget(h *lineHolder) {
+	if a == nil {
+		return
+	}
+	a.resolveRemoved(h, nil)
+	delete(a.checked, h)
+}
+
+// resolveRemoved resolves alerts on targets in h except ones of keys in
+// targets, which are removed from the statuses. A nil alerter does nothing.
+func (a *alerter) resolveRemoved(h *lineHolder, targets map[string]bool) {
+	if a == nil {
+		return
+	}
+	for key, s := range a.states {
+		if targets[key] || s.lh != h {
+			continue
+		}
+		if s.fired {
+			a.act(s.rule, fmt.Sprintf("RESOLVED %v (removed)", s.msg), false)
+		}
+		delete(a.states, key)
+	}
+}
+
+// act takes actions of the rule. The command and the bell are only on firing.
+func (a *alerter) act(r *alertRule, msg string, fired bool) {
+	if lf := a.logs[r.logFile]; lf != nil {
+		if _, err := fmt.Fprintf(lf, "%v %v\n",
+			time.Now().Format(time.RFC3339), msg); err != nil {
+			a.err = err
+		}
+	}
+	if !fired {
+		return
+	}
+	if r.bell {
+		fmt.Fprint(os.Stderr, "\a")
+	}
+	if r.command != "" {
+		var c *exec.Cmd
+		if runtime.GOOS == "windows" {
+			c = exec.Command("cmd", "/C", r.command)
+		} else {
+			c = exec.Command("sh", "-c", r.command)
+		}
+		c.Env = append(os.Environ(), "IOTOP_ALERT="+msg)
+		if err := c.Start(); err != nil {
+			a.err = fmt.Errorf("cannot run '%v', %v", r.command, err)
+			return
+		}
+		a.cmds.Add(1)
+		go func() {
+			defer a.cmds.Done()
+			c.Wait()
+		}()
+	}
+}
+
+// alertTargets returns sorted names of nodes, or keys of edges, which the
+// rule is evaluated on.
+func (h *prevLineHolder) alertTargets(r *alertRule) []string {
+	targets := []string{}
+	if r.kind == "edge" {
+		for key, l := range h.edges {
+			if r.match(l.senderName) || r.match(l.receiverName) {
+				targets = append(targets, key)
+			}
+		}
+	}
+	if r.kind == "source" || r.kind == "node" {
+		for name := range h.srcs {
+			if r.match(name) {
+				targets = append(targets, name)
+			}
+		}
+	}
+	if r.kind == "box" || r.kind == "node" {
+		for name := range h.boxes {
+			if r.match(name) {
+				targets = append(targets, name)
+			}
+		}
+	}
+	if r.kind == "sink" || r.kind == "node" {
+		for name := range h.sinks {
+			if r.match(name) {
+				targets = append(targets, name)
+			}
+		}
+	}
+	sort.Strings(targets)
+	return targets
+}
+
+// alertMetric returns the value of the metric of the target, and false when
+// the target does not have the metric or the rate is unknown yet.
+func (h *lineHolder) alertMetric(r *alertRule, target string) (float64, string, bool) {
+	if r.kind == "edge" {
+		return h.edges[target].queueFill() * 100, "", true
+	}
+	rate := func(cur, prev int64, ok bool) (float64, string, bool) {
+		if !ok {
+			return 0, "", false
+		}
+		v, ok := h.elapsedRate(cur - prev)
+		return v, "", ok
+	}
+	if l, ok := h.srcs[target]; ok {
+		prev, hasPrev := h.prev.srcs[target]
+		switch r.metric {
+		case "out_rate":
+			return rate(l.out, prev.out, hasPrev)
+		case "drop_rate":
+			return rate(l.dropped, prev.dropped, hasPrev)
+		case "dropped":
+			return float64(l.dropped), "", true
+		case "state":
+			return 0, l.state, true
+		}
+	}
+	if l, ok := h.boxes[target]; ok {
+		prev, hasPrev := h.prev.boxes[target]
+		switch r.metric {
+		case "in_rate":
+			return rate(l.in, prev.in, hasPrev)
+		case "out_rate":
+			return rate(l.out, prev.out, hasPrev)
+		case "drop_rate":
+			return rate(l.dropped, prev.dropped, hasPrev)
+		case "error_rate":
+			return rate(l.nerror, prev.nerror, hasPrev)
+		case "dropped":
+			return float64(l.dropped), "", true
+		case "errors":
+			return float64(l.nerror), "", true
+		case "state":
+			return 0, l.state, true
+		}
+	}
+	if l, ok := h.sinks[target]; ok {
+		prev, hasPrev := h.prev.sinks[target]
+		switch r.metric {
+		case "in_rate":
+			return rate(l.in, prev.in, hasPrev)
+		case "error_rate":
+			return rate(l.nerror, prev.nerror, hasPrev)
+		case "errors":
+			return float64(l.nerror), "", true
+		case "state":
+			return 0, l.state, true
+		}
+	}
+	return 0, "", false
+}
+
+// firedAlerts returns messages of fired alerts sorted.
+func (a *alerter) firedAlerts() []string {
+	if a == nil {
+		return nil
+	}
+	msgs := []string{}
+	for _, s := range a.states {
+		if s.fired {
+			msgs = append(msgs, s.msg)
+		}
+	}
+	sort.Strings(msgs)
+	return msgs
+}
+
+// alertStatus returns a message of fired alerts, or an empty string.
+func alertStatus(ms *MonitoringState) string {
+	msgs := []string{}
+	if ms.alerts != nil && ms.alerts.err != nil {
+		msgs = append(msgs, fmt.Sprintf("alert action failed (%v)", ms.alerts.err))
+	}
+	switch fired := ms.alerts.firedAlerts(); len(fired) {
+	case 0:
+	case 1:
+		msgs = append(msgs, "ALERT "+fired[0])
+	default:
+		msgs = append(msgs, fmt.Sprintf("%d ALERTS, %v, ...", len(fired), fired[0]))
+	}
+	return strings.Join(msgs, " | ")
+}
+
+// checkAlerts writes a failure of actions to w, and returns an error to exit
+// with alertExitCode when an alert with "exit" action fired.
+func (a *alerter) checkAlerts(w io.Writer) error {
+	if a == nil {
+		return nil
+	}
+	if a.err != nil {
+		fmt.Fprintf(w, "alert action failed, %v\n", a.err)
+		a.err = nil
+	}
+	if a.exitMsg != "" {
+		return cli.NewExitError(fmt.Sprintf("exit on alert, %v", a.exitMsg),
+			alertExitCode)
+	}
+	return nil
+}
+
+// Close waits for commands of alerts to finish, and closes log files. A nil
+// alerter does nothing.
+func (a *alerter) Close() error {
+	if a == nil {
+		return nil
+	}
+	a.cmds.Wait()
+	var err error
+	for _, lf := range a.logs {
+		if e := lf.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
@@ -0,0 +1,182 @@
+package iotop
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestParseAlertRule(t *testing.T) {
+	cases := []struct {
+		line     string
+		kind     string
+		metric   string
+		op       string
+		value    float64
+		state    string
+		duration time.Duration
+		command  string
+		logFile  string
+		bell     bool
+		exit     bool
+	}{
+		{line: "box filter_* drop_rate > 10/s for 30s then exec \"notify.sh a\" log alerts.log",
+			kind: "box", metric: "drop_rate", op: ">", value: 10,
+			duration: 30 * time.Second, command: "notify.sh a", logFile: "alerts.log"},
+		{line: "sink output state != running then bell exit",
+			kind: "sink", metric: "state", op: "!=", state: "running",
+			bell: true, exit: true},
+		{line: "edge * queue >= 90% for 1m",
+			kind: "edge", metric: "queue", op: ">=", value: 90,
+			duration: time.Minute},
+		{line: "  node /^in[0-9]+$/ errors == 0  ",
+			kind: "node", metric: "errors", op: "==", value: 0},
+	}
+	for _, c := range cases {
+		r, err := parseAlertRule(c.line)
+		if err != nil {
+			t.Errorf("%q: unexpected error, %v", c.line, err)
+			continue
+		}
+		if r.kind != c.kind || r.metric != c.metric || r.op != c.op ||
+			r.value != c.value || r.state != c.state || r.duration != c.duration {
+			t.Errorf("%q: got %v %v %v %v %q for %v", c.line, r.kind, r.metric,
+				r.op, r.value, r.state, r.duration)
+		}
+		if r.command != c.command || r.logFile != c.logFile || r.bell != c.bell ||
+			r.exit != c.exit {
+			t.Errorf("%q: got actions exec %q log %q bell %v exit %v", c.line,
+				r.command, r.logFile, r.bell, r.exit)
+		}
+	}
+}
+
+func TestParseAlertRuleError(t *testing.T) {
+	cases := []struct {
+		title string
+		line  string
+	}{
+		{"too few fields", "box b drop_rate >"},
+		{"invalid kind", "edges * queue > 10"},
+		{"invalid metric", "source s in_rate > 10"},
+		{"invalid operator", "box b drop_rate => 10"},
+		{"operator like assignment", "box b drop_rate = 10"},
+		{"ordered state", "box b state > running"},
+		{"invalid value", "box b drop_rate > ten"},
+		{"invalid duration", "box b drop_rate > 10 for 30"},
+		{"unknown unit", "box b drop_rate > 10 for 1x"},
+		{"missing then", "box b drop_rate > 10 bell"},
+		{"missing argument", "box b drop_rate > 10 then exec"},
+		{"invalid action", "box b drop_rate > 10 then mail"},
+		{"unterminated quote", "box b drop_rate > 10 then exec \"notify.sh"},
+		{"invalid regexp", "box /(/ drop_rate > 10"},
+	}
+	for _, c := range cases {
+		if _, err := parseAlertRule(c.line); err == nil {
+			t.Errorf("%v: %q should be an error", c.title, c.line)
+		}
+	}
+}
+
+func TestAlerterEvaluateHoldDown(t *testing.T) {
+	r, err := parseAlertRule("sink out state != running for 30s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &alerter{
+		rules:   []*alertRule{r},
+		states:  map[string]*alertState{},
+		logs:    map[string]*os.File{},
+		checked: map[*lineHolder]time.Time{},
+	}
+	h := newLineHolder()
+	start := time.Unix(1000, 0)
+
+	steps := []struct {
+		elapsed time.Duration
+		state   string
+		fired   int
+	}{
+		{0, "stopped", 0},
+		{10 * time.Second, "stopped", 0},
+		{29 * time.Second, "stopped", 0},
+		{30 * time.Second, "stopped", 1},
+		{40 * time.Second, "stopped", 1},
+		// resolved, and the duration starts again
+		{50 * time.Second, "running", 0},
+		{60 * time.Second, "stopped", 0},
+		{80 * time.Second, "stopped", 0},
+		{90 * time.Second, "stopped", 1},
+	}
+	for _, s := range steps {
+		h.current = start.Add(s.elapsed)
+		h.sinks["out"] = sinkLine{generalLine: &generalLine{name: "out",
+			nodeType: "sink", state: s.state}}
+		a.evaluate(h)
+		if fired := a.firedAlerts(); len(fired) != s.fired {
+			t.Errorf("after %v with %v: %d alerts fired, want %d, %v", s.elapsed,
+				s.state, len(fired), s.fired, fired)
+		}
+	}
+}
+
+func TestAlerterEvaluateRemovedTarget(t *testing.T) {
+	r, err := parseAlertRule("sink * state != running")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &alerter{
+		rules:   []*alertRule{r},
+		states:  map[string]*alertState{},
+		logs:    map[string]*os.File{},
+		checked: map[*lineHolder]time.Time{},
+	}
+	sinks := func(names ...string) map[string]sinkLine {
+		m := map[string]sinkLine{}
+		for _, n := range names {
+			m[n] = sinkLine{generalLine: &generalLine{name: n, nodeType: "sink",
+				state: "stopped"}}
+		}
+		return m
+	}
+	complete := func(h *lineHolder, ts int64, names ...string) {
+		h.last = &prevLineHolder{srcs: map[string]sourceLine{},
+			boxes: map[string]boxLine{}, sinks: sinks(names...),
+			edges: map[string]*edgeLine{}, current: time.Unix(ts, 0)}
+	}
+	h := newLineHolder()
+	h.topology = "t1"
+	other := newLineHolder()
+	other.topology = "t2"
+	for _, lh := range []*lineHolder{h, other} {
+		lh.sinks = sinks("a", "b")
+		a.evaluate(lh)
+	}
+	if fired := a.firedAlerts(); len(fired) != 4 {
+		t.Fatalf("%d alerts fired, want 4, %v", len(fired), fired)
+	}
+
+	// statuses of the next "ts" are being pushed
+	complete(h, 10, "a", "b")
+	h.sinks = sinks("b")
+	a.evaluate(h)
+	if fired := a.firedAlerts(); len(fired) != 4 {
+		t.Errorf("%d alerts fired while pushing statuses, want 4, %v",
+			len(fired), fired)
+	}
+
+	// a is removed from the complete statuses
+	complete(h, 20, "b")
+	h.sinks = sinks()
+	a.evaluate(h)
+	if fired := a.firedAlerts(); len(fired) != 3 {
+		t.Errorf("%d alerts fired after removing a sink, want 3, %v",
+			len(fired), fired)
+	}
+
+	a.forget(other)
+	if fired := a.firedAlerts(); len(fired) != 1 {
+		t.Errorf("%d alerts fired after forgetting other statuses, want 1, %v",
+			len(fired), fired)
+	}
+}
@@ -0,0 +1,138 @@
+package iotop
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// monitorBatch writes a snapshot of node I/O of each tab on every interval,
+// without terminal UI. It returns after ms.iterations refreshes which wrote
+// any snapshot, or never when the number of iterations is 0. On replay, it
+// returns after writing the last snapshot. While a stream is disconnected, a
+// message is written to stderr instead of the stale snapshot. Alert rules are
+// evaluated before each snapshot, and it returns an error to exit with
+// alertExitCode after the snapshots when an alert with "exit" action fired.
+func monitorBatch(w io.Writer, ms *MonitoringState, tabs []*monitorTab,
+	errChan <-chan error) error {
+	sw, err := newSnapshotWriter(w, ms)
+	if err != nil {
+		return err
+	}
+	defer sw.Close()
+
+	for i := 0; ms.iterations == 0 || i < ms.iterations; {
+		// wait for the first interval not to write an empty snapshot
+		select {
+		case err := <-errChan:
+			if err == errReplayFinished {
+				if _, err := writeTabSnapshots(sw, ms, tabs); err != nil {
+					return err
+				}
+				return ms.alerts.checkAlerts(os.Stderr)
+			}
+			return err
+		case <-time.After(ms.d):
+		}
+		written, err := writeTabSnapshots(sw, ms, tabs)
+		if err != nil {
+			return err
+		}
+		if err := ms.alerts.checkAlerts(os.Stderr); err != nil {
+			return err
+		}
+		if written {
+			i++
+		}
+	}
+	return nil
+}
+
+// writeTabSnapshots evaluates alert rules and writes a snapshot of each tab,
+// or a message to stderr while the stream of the tab is disconnected. Text
+// output is followed by the fleet table of each topology when multiple
+// servers are monitored. It returns false when no snapshot is written because
+// all streams are disconnected.
+func writeTabSnapshots(sw snapshotWriter, ms *MonitoringState,
+	tabs []*monitorTab) (bool, error) {
+	written := false
+	for _, t := range tabs {
+		if banner := disconnectedBanner(t.st); banner != "" {
+			if len(tabs) > 1 {
+				banner = ms.tabLabel(t.lh) + ": " + banner
+			}
+			fmt.Fprintln(os.Stderr, banner)
+			continue
+		}
+		ms.alerts.evaluate(t.lh)
+		if err := sw.writeSnapshot(ms, t.lh); err != nil {
+			return false, err
+		}
+		written = true
+	}
+	if t, ok := sw.(*textSnapshotWriter); ok && len(ms.servers) > 1 {
+		return written, t.writeFleet(ms, tabs)
+	}
+	return written, nil
+}
+
+// snapshotWriter writes a snapshot of node I/O in an output format.
+type snapshotWriter interface {
+	writeSnapshot(ms *MonitoringState, lh *lineHolder) error
+	Close() error
+}
+
+func newSnapshotWriter(w io.Writer, ms *MonitoringState) (snapshotWriter, error) {
+	switch ms.output {
+	case "json":
+		return &jsonSnapshotWriter{w: w}, nil
+	case "dot":
+		return &dotSnapshotWriter{w: w}, nil
+	case "csv":
+		if ms.csvDir != "" {
+			return newCSVDirSnapshotWriter(ms.csvDir)
+		}
+		return newCSVSnapshotWriter(w)
+	default:
+		return &textSnapshotWriter{w: w}, nil
+	}
+}
+
+type textSnapshotWriter struct {
+	w io.Writer
+}
+
+func (t *textSnapshotWriter) writeSnapshot(ms *MonitoringState, lh *lineHolder) error {
+	sep := time.Now().Format(time.RFC3339)
+	if len(ms.topologies) > 1 || len(ms.servers) > 1 {
+		sep += " " + ms.tabLabel(lh)
+	}
+	if _, err := fmt.Fprintf(t.w, "--- %v ---\n", sep); err != nil {
+		return err
+	}
+	if bn := lh.bottleneckStatus(ms); bn != "" {
+		if _, err := fmt.Fprintln(t.w, bn); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(t.w, "%v\n", lh.flush(ms))
+	return err
+}
+
+// writeFleet writes the fleet table of each topology on all servers.
+func (t *textSnapshotWriter) writeFleet(ms *MonitoringState,
+	tabs []*monitorTab) error {
+	for _, tpl := range tabTopologies(tabs) {
+		lines, _ := fleetTable(ms, tabs, tpl)
+		if _, err := fmt.Fprintf(t.w, "--- %v fleet %v ---\n%v\n",
+			time.Now().Format(time.RFC3339), tpl, lines); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *textSnapshotWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,101 @@
+package iotop
+
+import (
+	"fmt"
+	"sort"
+)
+
+// bottleneckMarker is appended to lines of bottleneck nodes, and edges to
+// them.
+const bottleneckMarker = "<- BOTTLENECK"
+
+// bottleneck is a node limiting throughput of the topology.
+type bottleneck struct {
+	node    string
+	inFill  float64 // the largest queue fill of edges to the node
+	inRate  float64 // tuples received by the node per second
+	upRate  float64 // tuples sent to the node per second
+	hasRate bool
+}
+
+// findBottlenecks returns nodes which cannot keep up with their inputs, from
+// the most congested one. A node is a bottleneck when a queue of an edge to
+// the node is filled over the warning threshold, while no queue of edges from
+// the node is, since nodes blocked by a slow node downstream also have full
+// input queues but their output queues are full too. Sources are never
+// bottlenecks because they have no inputs. The caller must hold the lock.
+func (h *lineHolder) findBottlenecks(ms *MonitoringState) []bottleneck {
+	inputs := map[string][]string{}
+	outFill := map[string]float64{}
+	for key, l := range h.edges {
+		if l.receiverName != "" {
+			inputs[l.receiverName] = append(inputs[l.receiverName], key)
+		}
+		if f := l.queueFill(); f > outFill[l.senderName] {
+			outFill[l.senderName] = f
+		}
+	}
+
+	bns := []bottleneck{}
+	for name, keys := range inputs {
+		if outFill[name] >= ms.queueWarn {
+			continue
+		}
+		b := bottleneck{node: name, hasRate: true}
+		for _, key := range keys {
+			l := h.edges[key]
+			if f := l.queueFill(); f > b.inFill {
+				b.inFill = f
+			}
+			prev, ok := h.prev.edges[key]
+			if !ok {
+				b.hasRate = false
+				continue
+			}
+			b.inRate += h.rate(l.received-prev.received, ms)
+			b.upRate += h.rate(l.sent-prev.sent, ms)
+		}
+		if b.inFill >= ms.queueWarn {
+			bns = append(bns, b)
+		}
+	}
+	sort.Slice(bns, func(i, j int) bool {
+		if bns[i].inFill != bns[j].inFill {
+			return bns[i].inFill > bns[j].inFill
+		}
+		return bns[i].node < bns[j].node
+	})
+	return bns
+}
+
+// bottleneckNodes returns the set of bottleneck nodes. The caller must hold
+// the lock.
+func (h *lineHolder) bottleneckNodes(ms *MonitoringState) map[string]bool {
+	nodes := map[string]bool{}
+	for _, b := range h.findBottlenecks(ms) {
+		nodes[b.node] = true
+	}
+	return nodes
+}
+
+// bottleneckStatus returns a message of the most congested bottleneck, or an
+// empty string when there is no bottleneck.
+func (h *lineHolder) bottleneckStatus(ms *MonitoringState) string {
+	h.rwm.RLock()
+	defer h.rwm.RUnlock()
+	bns := h.findBottlenecks(ms)
+	if len(bns) == 0 {
+		return ""
+	}
+	b := bns[0]
+	msg := fmt.Sprintf("bottleneck: %v (input queue %.0f%%", b.node, b.inFill*100)
+	if b.hasRate {
+		msg += fmt.Sprintf(", receiving %.2f of %.2f tuples/sec", b.inRate,
+			b.upRate)
+	}
+	msg += ")"
+	if len(bns) > 1 {
+		msg += fmt.Sprintf(" and %d more", len(bns)-1)
+	}
+	return msg
+}
@@ -0,0 +1,227 @@
+package iotop
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Column layouts of CSV output for each node kind. New columns must be
+// appended to the end not to break existing readers, and README.md must be
+// updated together.
+var (
+	edgeCSVHeader = []string{"timestamp", "sender", "sender_node_type",
+		"receiver", "receiver_node_type", "sender_queue_size", "sender_queued",
+		"sent", "receiver_queue_size", "receiver_queued", "received", "in_out",
+		"in_out_rate", "topology", "server"}
+	sourceCSVHeader = []string{"timestamp", "name", "node_type", "state",
+		"out", "out_rate", "dropped", "topology", "server"}
+	boxCSVHeader = []string{"timestamp", "name", "node_type", "state",
+		"in_out", "in_out_rate", "dropped", "errors", "topology", "server"}
+	sinkCSVHeader = []string{"timestamp", "name", "node_type", "state", "in",
+		"in_rate", "errors", "topology", "server"}
+)
+
+const (
+	edgeCSVKind   = "edge"
+	sourceCSVKind = "source"
+	boxCSVKind    = "box"
+	sinkCSVKind   = "sink"
+)
+
+var csvKinds = []string{edgeCSVKind, sourceCSVKind, boxCSVKind, sinkCSVKind}
+
+// csvFileNames are names of files in the directory of --csv-dir.
+var csvFileNames = map[string]string{
+	edgeCSVKind:   "edges.csv",
+	sourceCSVKind: "sources.csv",
+	boxCSVKind:    "boxes.csv",
+	sinkCSVKind:   "sinks.csv",
+}
+
+var csvHeaders = map[string][]string{
+	edgeCSVKind:   edgeCSVHeader,
+	sourceCSVKind: sourceCSVHeader,
+	boxCSVKind:    boxCSVHeader,
+	sinkCSVKind:   sinkCSVHeader,
+}
+
+// csvSnapshotWriter appends CSV records of node I/O on each snapshot. When
+// all kinds of records are written to one stream, each record and header is
+// prefixed with its kind to distinguish the column layouts.
+type csvSnapshotWriter struct {
+	writers map[string]*csv.Writer
+	files   []*os.File
+	prefix  bool
+}
+
+func newCSVSnapshotWriter(w io.Writer) (*csvSnapshotWriter, error) {
+	cw := csv.NewWriter(w)
+	c := &csvSnapshotWriter{
+		writers: map[string]*csv.Writer{},
+		prefix:  true,
+	}
+	for _, kind := range csvKinds {
+		c.writers[kind] = cw
+		if err := cw.Write(append([]string{kind}, csvHeaders[kind]...)); err != nil {
+			return nil, err
+		}
+	}
+	cw.Flush()
+	return c, cw.Error()
+}
+
+// newCSVDirSnapshotWriter opens "edges.csv", "sources.csv", "boxes.csv" and
+// "sinks.csv" in the directory to append records. Headers are written only
+// to new files.
+func newCSVDirSnapshotWriter(dir string) (_ *csvSnapshotWriter, err error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("cannot create CSV directory, %v", err)
+	}
+	c := &csvSnapshotWriter{
+		writers: map[string]*csv.Writer{},
+	}
+	defer func() {
+		if err != nil {
+			c.Close()
+		}
+	}()
+	for _, kind := range csvKinds {
+		fn := filepath.Join(dir, csvFileNames[kind])
+		f, err := os.OpenFile(fn, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("cannot open CSV file, %v", err)
+		}
+		c.files = append(c.files, f)
+		cw := csv.NewWriter(f)
+		c.writers[kind] = cw
+
+		fi, err := f.Stat()
+		if err != nil {
+			return nil, fmt.Errorf("cannot stat CSV file, %v", err)
+		}
+		if fi.Size() > 0 {
+			continue
+		}
+		if err := cw.Write(csvHeaders[kind]); err != nil {
+			return nil, err
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *csvSnapshotWriter) writeSnapshot(ms *MonitoringState, lh *lineHolder) error {
+	records := lh.flushCSV(ms)
+	for _, kind := range csvKinds {
+		cw := c.writers[kind]
+		for _, r := range records[kind] {
+			if c.prefix {
+				r = append([]string{kind}, r...)
+			}
+			if err := cw.Write(r); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *csvSnapshotWriter) Close() error {
+	var err error
+	for _, f := range c.files {
+		if e := f.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// flushCSV returns current node I/O as CSV records for each node kind. Rate
+// columns are empty on the first snapshot of the node.
+func (h *lineHolder) flushCSV(ms *MonitoringState) map[string][][]string {
+	h.rwm.RLock()
+	defer h.rwm.RUnlock()
+	ts := h.current.Format(time.RFC3339Nano)
+	i := strconv.FormatInt
+	rate := func(diff int64) string {
+		return strconv.FormatFloat(h.rate(diff, ms), 'f', 2, 64)
+	}
+	records := map[string][][]string{}
+
+	if !ms.hideEdge {
+		for _, name := range edgeLineMap(h.edges).sortedKeys() {
+			l := h.edges[name]
+			if !ms.filter.matchEdge(l) {
+				continue
+			}
+			r := ""
+			if prev, ok := h.prev.edges[name]; ok {
+				r = rate(l.inOut - prev.inOut)
+			}
+			records[edgeCSVKind] = append(records[edgeCSVKind], []string{ts,
+				l.senderName, l.senderNodeType, l.receiverName,
+				l.receiverNodeType, i(l.senderQueueSize, 10),
+				i(l.senderQueued, 10), i(l.sent, 10),
+				i(l.receiverQueueSize, 10), i(l.receiverQueued, 10),
+				i(l.received, 10), i(l.inOut, 10), r, h.topology, h.server})
+		}
+	}
+	if !ms.hideSrc {
+		for _, name := range sourceLineMap(h.srcs).sortedKeys() {
+			l := h.srcs[name]
+			if !ms.filter.match(l.name) {
+				continue
+			}
+			r := ""
+			if prev, ok := h.prev.srcs[name]; ok {
+				r = rate(l.out - prev.out)
+			}
+			records[sourceCSVKind] = append(records[sourceCSVKind], []string{ts,
+				l.name, l.nodeType, l.state, i(l.out, 10), r,
+				i(l.dropped, 10), h.topology, h.server})
+		}
+	}
+	if !ms.hideBox {
+		for _, name := range boxLineMap(h.boxes).sortedKeys() {
+			l := h.boxes[name]
+			if !ms.filter.match(l.name) {
+				continue
+			}
+			r := ""
+			if prev, ok := h.prev.boxes[name]; ok {
+				r = rate(l.inOut - prev.inOut)
+			}
+			records[boxCSVKind] = append(records[boxCSVKind], []string{ts,
+				l.name, l.nodeType, l.state, i(l.inOut, 10), r,
+				i(l.dropped, 10), i(l.nerror, 10), h.topology, h.server})
+		}
+	}
+	if !ms.hideSink {
+		for _, name := range sinkLineMap(h.sinks).sortedKeys() {
+			l := h.sinks[name]
+			if !ms.filter.match(l.name) {
+				continue
+			}
+			r := ""
+			if prev, ok := h.prev.sinks[name]; ok {
+				r = rate(l.in - prev.in)
+			}
+			records[sinkCSVKind] = append(records[sinkCSVKind], []string{ts,
+				l.name, l.nodeType, l.state, i(l.in, 10), r,
+				i(l.nerror, 10), h.topology, h.server})
+		}
+	}
+	return records
+}
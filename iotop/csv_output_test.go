@@ -0,0 +1,78 @@
+package iotop
+
+import (
+	"bytes"
+	"encoding/csv"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestNewCSVDirSnapshotWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "iotop_csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, err := newCSVDirSnapshotWriter(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, fi := range fis {
+		names = append(names, fi.Name())
+	}
+	sort.Strings(names)
+	want := []string{"boxes.csv", "edges.csv", "sinks.csv", "sources.csv"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("got files %q, want %q", names, want)
+	}
+
+	for kind, fn := range csvFileNames {
+		f, err := os.Open(filepath.Join(dir, fn))
+		if err != nil {
+			t.Fatal(err)
+		}
+		records, err := csv.NewReader(f).ReadAll()
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != 1 || !reflect.DeepEqual(records[0], csvHeaders[kind]) {
+			t.Errorf("%v: got %q, want the header of %v", fn, records, kind)
+		}
+	}
+}
+
+func TestNewCSVSnapshotWriterHeaders(t *testing.T) {
+	b := bytes.NewBuffer(nil)
+	if _, err := newCSVSnapshotWriter(b); err != nil {
+		t.Fatal(err)
+	}
+	r := csv.NewReader(b)
+	r.FieldsPerRecord = -1 // layouts differ by kinds
+	records, err := r.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != len(csvKinds) {
+		t.Fatalf("got %d headers, want %d", len(records), len(csvKinds))
+	}
+	for i, kind := range csvKinds {
+		want := append([]string{kind}, csvHeaders[kind]...)
+		if !reflect.DeepEqual(records[i], want) {
+			t.Errorf("got header %q, want %q", records[i], want)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package iotop
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+)
+
+// fields of a node status shown in their own sections of the detail view
+var detailSectionFields = map[string]bool{
+	"node_name":    true,
+	"node_type":    true,
+	"state":        true,
+	"output_stats": true,
+	"input_stats":  true,
+	"ts":           true,
+}
+
+// detailStatus returns a message in the detail view, or an empty string.
+func detailStatus(ms *MonitoringState) string {
+	if ms.detailNode == "" {
+		return ""
+	}
+	return fmt.Sprintf("detail of '%v' (Esc to go back)", ms.detailNode)
+}
+
+// findLine returns the node of the name in the current statuses, or in the
+// previous ones when the current statuses of the node are not pushed yet.
+func (h *lineHolder) findLine(name string) (*generalLine, bool) {
+	if l, ok := h.srcs[name]; ok {
+		return l.generalLine, true
+	}
+	if l, ok := h.boxes[name]; ok {
+		return l.generalLine, true
+	}
+	if l, ok := h.sinks[name]; ok {
+		return l.generalLine, true
+	}
+	if l, ok := h.prev.srcs[name]; ok {
+		return l.generalLine, true
+	}
+	if l, ok := h.prev.boxes[name]; ok {
+		return l.generalLine, true
+	}
+	if l, ok := h.prev.sinks[name]; ok {
+		return l.generalLine, true
+	}
+	return nil, false
+}
+
+// detail returns everything known about the node: its state, the number of
+// restarts and the last state change, all fields of the status including
+// input and output pipes, the history of rates and neighbour nodes.
+func (h *lineHolder) detail(name string) string {
+	h.rwm.RLock()
+	defer h.rwm.RUnlock()
+	b := bytes.NewBuffer(nil)
+	w := tabwriter.NewWriter(b, 0, 0, 1, ' ', 0)
+
+	l, ok := h.findLine(name)
+	if !ok {
+		fmt.Fprintf(w, "node '%v' is not found (Esc to go back)\n", name)
+		w.Flush()
+		return b.String()
+	}
+	fmt.Fprintf(w, "NAME\t%v\n", l.name)
+	fmt.Fprintf(w, "NTYPE\t%v\n", l.nodeType)
+	fmt.Fprintf(w, "STATE\t%v\n", l.state)
+	fmt.Fprintf(w, "RESTARTS\t%d\n", h.restarts[name])
+	if c, ok := h.stateChanges[name]; ok {
+		fmt.Fprintf(w, "STATE CHANGE\t%v\n", c)
+	}
+
+	for _, sec := range []struct {
+		title string
+		field string
+	}{
+		{"OUTPUT STATS", "output_stats"},
+		{"INPUT STATS", "input_stats"},
+	} {
+		m, err := data.AsMap(l.raw[sec.field])
+		if err != nil {
+			continue
+		}
+		fmt.Fprintln(w, "")
+		fmt.Fprintln(w, sec.title)
+		printRawMap(w, m, "  ")
+	}
+
+	others := data.Map{}
+	for k, v := range l.raw {
+		if !detailSectionFields[k] {
+			others[k] = v
+		}
+	}
+	if len(others) > 0 {
+		fmt.Fprintln(w, "")
+		fmt.Fprintln(w, "OTHER FIELDS")
+		printRawMap(w, others, "  ")
+	}
+
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "RATE HISTORY [tuples/sec], from the oldest")
+	if hist, ok := h.history[name]; ok {
+		rates := []string{}
+		for _, r := range hist.list() {
+			rates = append(rates, fmt.Sprintf("%.2f", r))
+		}
+		fmt.Fprintf(w, "  %v\n", strings.Join(rates, " "))
+	} else {
+		fmt.Fprintln(w, "  (no history yet)")
+	}
+
+	up, down := h.neighbours(name)
+	fmt.Fprintln(w, "")
+	fmt.Fprintf(w, "UPSTREAM\t%v\n", strings.Join(up, ", "))
+	fmt.Fprintf(w, "DOWNSTREAM\t%v\n", strings.Join(down, ", "))
+
+	w.Flush()
+	return b.String()
+}
+
+// neighbours returns sorted names of nodes sending to and receiving from the
+// node.
+func (h *lineHolder) neighbours(name string) (up []string, down []string) {
+	for _, l := range h.edges {
+		if l.receiverName == name && l.senderName != "" {
+			up = append(up, l.senderName)
+		}
+		if l.senderName == name && l.receiverName != "" {
+			down = append(down, l.receiverName)
+		}
+	}
+	sort.Strings(up)
+	sort.Strings(down)
+	return
+}
+
+// printRawMap prints fields of the map sorted by keys, and nested maps with
+// deeper indents.
+func printRawMap(w io.Writer, m data.Map, indent string) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if sub, err := data.AsMap(m[k]); err == nil {
+			fmt.Fprintf(w, "%s%s:\n", indent, k)
+			printRawMap(w, sub, indent+"  ")
+			continue
+		}
+		fmt.Fprintf(w, "%s%s:\t%v\n", indent, k, m[k])
+	}
+}
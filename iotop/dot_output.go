@@ -0,0 +1,158 @@
+package iotop
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+)
+
+// fill colors of nodes for each node type in DOT output
+var dotNodeColors = map[string]string{
+	"source": "lightblue",
+	"box":    "lightyellow",
+	"sink":   "palegreen",
+}
+
+// colors of edges for each level in DOT output
+var dotEdgeColors = map[rowLevel]string{
+	rowNormal:   "black",
+	rowWarning:  "orange",
+	rowCritical: "red",
+}
+
+// flushDOT returns the topology as a Graphviz DOT graph. Nodes are filled in
+// colors of their node types and outlined in red when they are not running,
+// and edges are labelled with tuples/sec received through them and their
+// queue fills, and colored by the queue fill thresholds.
+func (h *lineHolder) flushDOT(ms *MonitoringState) []byte {
+	h.rwm.RLock()
+	defer h.rwm.RUnlock()
+	b := bytes.NewBuffer(nil)
+
+	fmt.Fprintf(b, "// sensorbee-iotop snapshot at %v\n",
+		h.current.Format(time.RFC3339))
+	name := "topology"
+	if h.topology != "" {
+		name = ms.tabLabel(h)
+	}
+	fmt.Fprintf(b, "digraph %v {\n", dotQuote(name))
+	fmt.Fprintln(b, "  rankdir=LR;")
+	fmt.Fprintln(b, "  node [style=filled];")
+
+	nodes := map[string]string{} // node types of nodes
+	edgeKeys := []string{}
+	for _, key := range edgeLineMap(h.edges).sortedKeys() {
+		l := h.edges[key]
+		if l.senderName == "" || l.receiverName == "" ||
+			!ms.filter.matchEdge(l) {
+			continue
+		}
+		edgeKeys = append(edgeKeys, key)
+		nodes[l.senderName] = l.senderNodeType
+		nodes[l.receiverName] = l.receiverNodeType
+	}
+	for name := range h.srcs {
+		if ms.filter.match(name) {
+			nodes[name] = "source"
+		}
+	}
+	for name := range h.boxes {
+		if ms.filter.match(name) {
+			nodes[name] = "box"
+		}
+	}
+	for name := range h.sinks {
+		if ms.filter.match(name) {
+			nodes[name] = "sink"
+		}
+	}
+
+	names := make([]string, 0, len(nodes))
+	for name := range nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		nodeType := nodes[name]
+		label := fmt.Sprintf("%v\n%v", name, nodeType)
+		border := "black"
+		if l, ok := h.findLine(name); ok {
+			label += ", " + l.state
+			if l.state != "running" {
+				border = "red"
+			}
+		}
+		shape := "box"
+		if nodeType != "box" {
+			shape = "ellipse"
+		}
+		fillColor, ok := dotNodeColors[nodeType]
+		if !ok {
+			fillColor = "white"
+		}
+		fmt.Fprintf(b, "  %v [label=%v, shape=%v, fillcolor=%v, color=%v];\n",
+			dotQuote(name), dotQuote(label), shape, fillColor, border)
+	}
+
+	for _, key := range edgeKeys {
+		l := h.edges[key]
+		var label string
+		if prev, ok := h.prev.edges[key]; ok && !ms.absFlag {
+			label = fmt.Sprintf("%.2f tuples/s", h.rate(l.received-prev.received, ms))
+		} else {
+			label = fmt.Sprintf("%d tuples", l.received)
+		}
+		label += fmt.Sprintf("\nqueue %.0f%%", l.queueFill()*100)
+		fmt.Fprintf(b, "  %v -> %v [label=%v, color=%v];\n",
+			dotQuote(l.senderName), dotQuote(l.receiverName), dotQuote(label),
+			dotEdgeColors[l.level(ms)])
+	}
+	fmt.Fprintln(b, "}")
+	return b.Bytes()
+}
+
+// dotQuote returns the string as a quoted DOT ID, in which new lines are
+// written as "\n" to break lines of labels.
+func dotQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + r.Replace(s) + `"`
+}
+
+type dotSnapshotWriter struct {
+	w io.Writer
+}
+
+func (d *dotSnapshotWriter) writeSnapshot(ms *MonitoringState, lh *lineHolder) error {
+	_, err := d.w.Write(lh.flushDOT(ms))
+	return err
+}
+
+func (d *dotSnapshotWriter) Close() error {
+	return nil
+}
+
+// dumpDOT writes the current topology as a DOT graph to a file in the current
+// directory, and shows the file name.
+func dumpDOT(ms *MonitoringState, lh *lineHolder, eb *editBox) (done struct{}) {
+	done = struct{}{}
+	defer eb.reset()
+
+	fn := fmt.Sprintf("iotop_%v.dot", time.Now().Format("20060102T150405"))
+	if lh.topology != "" {
+		// ':' of the port is not allowed in file names on some platforms
+		name := strings.NewReplacer("@", "_", ":", "_").Replace(ms.tabLabel(lh))
+		fn = fmt.Sprintf("iotop_%v_%v.dot", name,
+			time.Now().Format("20060102T150405"))
+	}
+	if err := ioutil.WriteFile(fn, lh.flushDOT(ms), 0644); err != nil {
+		eb.redrawAll(fmt.Sprintf("Cannot write a DOT graph, %v", err))
+	} else {
+		eb.redrawAll(fmt.Sprintf("DOT graph is written to %v", fn))
+	}
+	<-time.After(2 * time.Second)
+	return
+}
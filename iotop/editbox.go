@@ -2,6 +2,7 @@ package iotop
 
 import (
 	"fmt"
+	"strings"
 	"unicode/utf8"
 
 	runewidth "github.com/mattn/go-runewidth"
@@ -13,9 +14,10 @@ import (
 type editBox struct {
 	text          []byte
 	lineVOffset   int
-	cursorBOffset int // cursor offset in bytes
-	cursorVOffset int // visual cursor offset in termbox cells
-	cursorCOffset int // cursor offset in unicode code points
+	cursorBOffset int      // cursor offset in bytes
+	cursorVOffset int      // visual cursor offset in termbox cells
+	cursorCOffset int      // cursor offset in unicode code points
+	candidates    []string // completed by Tab key, a tab is inserted when nil
 }
 
 const (
@@ -42,6 +44,7 @@ func (eb *editBox) reset() {
 	eb.cursorBOffset = 0
 	eb.cursorVOffset = 0
 	eb.cursorCOffset = 0
+	eb.candidates = nil
 	termbox.HideCursor()
 }
 
@@ -68,7 +71,11 @@ func (eb *editBox) start(prefix string) (string, error) {
 			case termbox.KeyDelete, termbox.KeyCtrlD:
 				eb.deleteRuneForward()
 			case termbox.KeyTab:
-				eb.insertRune('\t')
+				if eb.candidates != nil {
+					eb.complete()
+				} else {
+					eb.insertRune('\t')
+				}
 			case termbox.KeySpace:
 				eb.insertRune(' ')
 			case termbox.KeyCtrlK:
@@ -227,6 +234,34 @@ func (eb *editBox) deleteTheRestOfTheLine() {
 	eb.text = eb.text[:eb.cursorBOffset]
 }
 
+// complete replaces the text with the longest common prefix of candidates
+// starting with it.
+func (eb *editBox) complete() {
+	text := string(eb.text)
+	p := ""
+	found := false
+	for _, c := range eb.candidates {
+		if !strings.HasPrefix(c, text) {
+			continue
+		}
+		if !found {
+			p, found = c, true
+			continue
+		}
+		for !strings.HasPrefix(c, p) {
+			p = p[:len(p)-1]
+		}
+	}
+	if !found {
+		return
+	}
+	for !utf8.ValidString(p) {
+		p = p[:len(p)-1]
+	}
+	eb.text = []byte(p)
+	eb.moveCursorToEndOfTheLine()
+}
+
 func (eb *editBox) insertRune(r rune) {
 	var buf [utf8.UTFMax]byte
 	n := utf8.EncodeRune(buf[:], r)
@@ -0,0 +1,40 @@
+package iotop
+
+import "testing"
+
+func TestEditBoxComplete(t *testing.T) {
+	cases := []struct {
+		title      string
+		text       string
+		candidates []string
+		want       string
+	}{
+		{"no match", "x", []string{"ingest", "filter"}, "x"},
+		{"no candidates", "x", []string{}, "x"},
+		{"single match", "f", []string{"ingest", "filter"}, "filter"},
+		{"exact match", "filter", []string{"filter", "ingest"}, "filter"},
+		{"multiple matches", "in", []string{"ingest_a", "ingest_b", "filter"},
+			"ingest_"},
+		{"one is a prefix of another", "", []string{"ingest", "ingest_a"},
+			"ingest"},
+		{"no common prefix longer than the text", "i",
+			[]string{"in", "it"}, "i"},
+		{"empty text", "", []string{"ingest_a", "ingest_b"}, "ingest_"},
+		{"multibyte", "あ", []string{"あい", "あう"}, "あ"},
+		{"multibyte after ascii", "t", []string{"t日本", "t日曜"}, "t日"},
+	}
+	for _, c := range cases {
+		eb := &editBox{candidates: c.candidates}
+		for _, r := range c.text {
+			eb.insertRune(r)
+		}
+		eb.complete()
+		if got := string(eb.text); got != c.want {
+			t.Errorf("%v: got %q, want %q", c.title, got, c.want)
+		}
+		if eb.cursorBOffset != len(eb.text) {
+			t.Errorf("%v: the cursor is at %d, want the end %d", c.title,
+				eb.cursorBOffset, len(eb.text))
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package iotop
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// eventLogLength is the number of events kept in the session.
+const eventLogLength = 1000
+
+// eventPaneHeight is the number of events shown in the bottom pane.
+const eventPaneHeight = 6
+
+// event is a change of nodes or edges between node statuses.
+type event struct {
+	ts  time.Time // "ts" of the statuses where the change is found
+	msg string
+}
+
+func (e event) String() string {
+	return fmt.Sprintf("%v %v", e.ts.Format("2006-01-02 15:04:05"), e.msg)
+}
+
+// eventNode is a node compared between statuses to find events.
+type eventNode struct {
+	nodeType string
+	state    string
+	dropped  int64
+	nerror   int64
+}
+
+func eventNodes(srcs map[string]sourceLine, boxes map[string]boxLine,
+	sinks map[string]sinkLine) map[string]eventNode {
+	nodes := map[string]eventNode{}
+	for name, l := range srcs {
+		nodes[name] = eventNode{l.nodeType, l.state, l.dropped, 0}
+	}
+	for name, l := range boxes {
+		nodes[name] = eventNode{l.nodeType, l.state, l.dropped, l.nerror}
+	}
+	for name, l := range sinks {
+		nodes[name] = eventNode{l.nodeType, l.state, 0, l.nerror}
+	}
+	return nodes
+}
+
+// recordEvents adds changes between the current and the previous statuses to
+// the event log. It is called when all statuses of the current timestamp are
+// pushed. Nodes in the first statuses are not logged as added.
+func (h *lineHolder) recordEvents() {
+	cur := eventNodes(h.srcs, h.boxes, h.sinks)
+	prev := eventNodes(h.prev.srcs, h.prev.boxes, h.prev.sinks)
+	first := len(prev) == 0 && len(h.prev.edges) == 0
+	msgs := []string{}
+
+	for name, l := range cur {
+		p, ok := prev[name]
+		switch {
+		case h.restarted[name]:
+			msgs = append(msgs, fmt.Sprintf("%v %v restarted (%v)", l.nodeType,
+				name, l.state))
+		case !ok && !first:
+			msgs = append(msgs, fmt.Sprintf("%v %v added (%v)", l.nodeType,
+				name, l.state))
+		}
+		if !ok {
+			continue
+		}
+		if p.state != l.state {
+			msgs = append(msgs, fmt.Sprintf("%v %v state changed, %v -> %v",
+				l.nodeType, name, p.state, l.state))
+		}
+		dropping := l.dropped > p.dropped
+		if dropping && !h.dropping[name] {
+			msgs = append(msgs, fmt.Sprintf("%v %v started dropping tuples (+%d)",
+				l.nodeType, name, l.dropped-p.dropped))
+		}
+		h.dropping[name] = dropping
+		if l.nerror > p.nerror {
+			msgs = append(msgs, fmt.Sprintf("%v %v errors increased (+%d)",
+				l.nodeType, name, l.nerror-p.nerror))
+		}
+	}
+	for name, p := range prev {
+		if _, ok := cur[name]; !ok {
+			msgs = append(msgs, fmt.Sprintf("%v %v removed", p.nodeType, name))
+			delete(h.dropping, name)
+		}
+	}
+
+	for key, l := range h.edges {
+		full := (l.senderQueueSize > 0 && l.senderQueued >= l.senderQueueSize) ||
+			(l.receiverQueueSize > 0 && l.receiverQueued >= l.receiverQueueSize)
+		if full != h.fullQueues[key] {
+			if full {
+				msgs = append(msgs, fmt.Sprintf("queue %v -> %v became full",
+					l.senderName, l.receiverName))
+			} else {
+				msgs = append(msgs, fmt.Sprintf("queue %v -> %v is no longer full",
+					l.senderName, l.receiverName))
+			}
+		}
+		h.fullQueues[key] = full
+	}
+	for key := range h.fullQueues {
+		if _, ok := h.edges[key]; !ok {
+			delete(h.fullQueues, key)
+		}
+	}
+
+	sort.Strings(msgs)
+	for _, m := range msgs {
+		h.events = append(h.events, event{ts: h.current, msg: m})
+	}
+	if n := len(h.events) - eventLogLength; n > 0 {
+		h.events = append([]event{}, h.events[n:]...)
+	}
+}
+
+// eventLines returns all events from the oldest.
+func (h *lineHolder) eventLines() string {
+	h.rwm.RLock()
+	defer h.rwm.RUnlock()
+	if len(h.events) == 0 {
+		return "no events yet (E to go back)\n"
+	}
+	b := bytes.NewBuffer(nil)
+	for _, e := range h.events {
+		fmt.Fprintln(b, e)
+	}
+	return b.String()
+}
+
+// eventPane returns lines of the bottom pane, a separator and the latest
+// events, or nil when the pane is hidden.
+func (h *lineHolder) eventPane(ms *MonitoringState) []string {
+	if !ms.eventPane {
+		return nil
+	}
+	h.rwm.RLock()
+	defer h.rwm.RUnlock()
+	lines := []string{"--- events (e to hide, E to show all) ---"}
+	events := h.events
+	if len(events) > eventPaneHeight {
+		events = events[len(events)-eventPaneHeight:]
+	}
+	for _, e := range events {
+		lines = append(lines, e.String())
+	}
+	return lines
+}
+
+// eventStatus returns a message in the event log view, or an empty string.
+func eventStatus(ms *MonitoringState) string {
+	if !ms.eventView || ms.detailNode != "" {
+		return ""
+	}
+	return "event log (E to go back)"
+}
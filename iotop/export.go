@@ -0,0 +1,206 @@
+package iotop
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// RunExport runs 'sensorbee-iotop export' command, which serves node I/O as
+// Prometheus metrics.
+func RunExport(c *cli.Context) error {
+	tpl := c.String("topology")
+	if tpl == "" {
+		names, err := listTopologies(c.String("uri"), c.String("api-version"))
+		if err != nil {
+			return err
+		}
+		if len(names) == 0 {
+			return fmt.Errorf("there is no topology on the server")
+		}
+		if len(names) > 1 {
+			return fmt.Errorf("topology must be specified by --topology, one of %v",
+				strings.Join(names, ", "))
+		}
+		tpl = names[0]
+	}
+	req, err := newNodeStatusRequester(c.String("uri"), c.String("api-version"),
+		tpl)
+	if err != nil {
+		return err
+	}
+	return Export(c.String("listen"), tpl, req, c.Bool("gc-sources"))
+}
+
+// Export serves the latest node I/O on "/metrics" of the listen address in
+// Prometheus text format. It responds 503 while the status stream is
+// reconnecting. Sources left by dead sessions are dropped when gcSources is
+// true.
+func Export(listen, tpl string, req StatusRequester, gcSources bool) error {
+	cleanUpStaleStatusSources(os.Stderr, req, gcSources)
+
+	lh := newLineHolder()
+	st := newNodeStatusStream(req, lh, nil)
+	if err := st.start(1.0); err != nil {
+		return err
+	}
+	defer func() {
+		if err := st.stop(); err != nil {
+			fmt.Fprintf(os.Stderr, "cannot drop the source '%v', %v\n",
+				st.name, err)
+		}
+	}()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		// not to serve stale metrics while reconnecting
+		if err := st.connectionError(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		lh.writeMetrics(w, tpl)
+	})
+	srvErrChan := make(chan error, 1)
+	go func() {
+		srvErrChan <- http.ListenAndServe(listen, mux)
+	}()
+
+	select {
+	case err := <-st.errorsOrSignal():
+		return err
+	case err := <-srvErrChan:
+		return fmt.Errorf("cannot serve metrics, %v", err)
+	}
+}
+
+type metricSample struct {
+	labels []string // pairs of a label name and its value
+	value  int64
+}
+
+type metricFamily struct {
+	name    string
+	help    string
+	typ     string
+	samples []metricSample
+}
+
+func (f *metricFamily) add(value int64, labels ...string) {
+	f.samples = append(f.samples, metricSample{
+		labels: labels,
+		value:  value,
+	})
+}
+
+func (f *metricFamily) write(w io.Writer) {
+	if len(f.samples) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, f.help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.typ)
+	for _, s := range f.samples {
+		ls := make([]string, 0, len(s.labels)/2)
+		for i := 0; i+1 < len(s.labels); i += 2 {
+			ls = append(ls, fmt.Sprintf(`%s="%s"`, s.labels[i],
+				escapeLabelValue(s.labels[i+1])))
+		}
+		fmt.Fprintf(w, "%s{%s} %d\n", f.name, strings.Join(ls, ","), s.value)
+	}
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(v string) string {
+	return labelValueReplacer.Replace(v)
+}
+
+// writeMetrics writes node I/O of the last complete statuses in Prometheus
+// text format, not to lose nodes not pushed yet in the current statuses.
+// Metric families without any samples are skipped, and nothing is written
+// until the first statuses are completed.
+func (h *lineHolder) writeMetrics(w io.Writer, tpl string) {
+	h.rwm.RLock()
+	defer h.rwm.RUnlock()
+	last := h.last
+	if last == nil {
+		return
+	}
+
+	sent := &metricFamily{name: "sensorbee_node_sent_total",
+		help: "Total number of tuples sent by the node.", typ: "counter"}
+	received := &metricFamily{name: "sensorbee_node_received_total",
+		help: "Total number of tuples received by the node.", typ: "counter"}
+	dropped := &metricFamily{name: "sensorbee_node_dropped_total",
+		help: "Total number of tuples dropped by the node.", typ: "counter"}
+	errs := &metricFamily{name: "sensorbee_node_errors_total",
+		help: "Total number of errors occurred in the node.", typ: "counter"}
+	state := &metricFamily{name: "sensorbee_node_state",
+		help: "State of the node, always 1 with the state label.", typ: "gauge"}
+
+	nodeLabels := func(l *generalLine) []string {
+		return []string{"topology", tpl, "node", l.name, "node_type",
+			l.nodeType}
+	}
+	stateLabels := func(l *generalLine) []string {
+		return append(nodeLabels(l), "state", l.state)
+	}
+	for _, name := range sourceLineMap(last.srcs).sortedKeys() {
+		l := last.srcs[name]
+		sent.add(l.out, nodeLabels(l.generalLine)...)
+		dropped.add(l.dropped, nodeLabels(l.generalLine)...)
+		state.add(1, stateLabels(l.generalLine)...)
+	}
+	for _, name := range boxLineMap(last.boxes).sortedKeys() {
+		l := last.boxes[name]
+		sent.add(l.out, nodeLabels(l.generalLine)...)
+		received.add(l.in, nodeLabels(l.generalLine)...)
+		dropped.add(l.dropped, nodeLabels(l.generalLine)...)
+		errs.add(l.nerror, nodeLabels(l.generalLine)...)
+		state.add(1, stateLabels(l.generalLine)...)
+	}
+	for _, name := range sinkLineMap(last.sinks).sortedKeys() {
+		l := last.sinks[name]
+		received.add(l.in, nodeLabels(l.generalLine)...)
+		errs.add(l.nerror, nodeLabels(l.generalLine)...)
+		state.add(1, stateLabels(l.generalLine)...)
+	}
+
+	edgeSent := &metricFamily{name: "sensorbee_edge_sent_total",
+		help: "Total number of tuples sent through the edge.", typ: "counter"}
+	edgeReceived := &metricFamily{name: "sensorbee_edge_received_total",
+		help: "Total number of tuples received through the edge.",
+		typ:  "counter"}
+	senderQueueSize := &metricFamily{name: "sensorbee_edge_sender_queue_size",
+		help: "Queue size of the sender side of the edge.", typ: "gauge"}
+	senderQueued := &metricFamily{name: "sensorbee_edge_sender_queued",
+		help: "Number of tuples queued in the sender side of the edge.",
+		typ:  "gauge"}
+	receiverQueueSize := &metricFamily{name: "sensorbee_edge_receiver_queue_size",
+		help: "Queue size of the receiver side of the edge.", typ: "gauge"}
+	receiverQueued := &metricFamily{name: "sensorbee_edge_receiver_queued",
+		help: "Number of tuples queued in the receiver side of the edge.",
+		typ:  "gauge"}
+	for _, name := range edgeLineMap(last.edges).sortedKeys() {
+		l := last.edges[name]
+		labels := []string{"topology", tpl, "sender", l.senderName,
+			"sender_type", l.senderNodeType, "receiver", l.receiverName,
+			"receiver_type", l.receiverNodeType}
+		edgeSent.add(l.sent, labels...)
+		edgeReceived.add(l.received, labels...)
+		senderQueueSize.add(l.senderQueueSize, labels...)
+		senderQueued.add(l.senderQueued, labels...)
+		receiverQueueSize.add(l.receiverQueueSize, labels...)
+		receiverQueued.add(l.receiverQueued, labels...)
+	}
+
+	for _, f := range []*metricFamily{sent, received, dropped, errs, state,
+		edgeSent, edgeReceived, senderQueueSize, senderQueued,
+		receiverQueueSize, receiverQueued} {
+		f.write(w)
+	}
+}
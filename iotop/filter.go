@@ -0,0 +1,182 @@
+package iotop
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// nameFilter filters nodes by their names. The expression is a list of
+// patterns separated by spaces, each pattern is a glob like "ingest_*" or a
+// regular expression enclosed in slashes like "/^ingest_[0-9]+$/", which can
+// contain spaces, and prefixed with '!' to exclude matched nodes. A node is
+// shown when it matches one of including patterns, or there are no including
+// patterns, and it does not match any excluding patterns.
+type nameFilter struct {
+	expr     string
+	includes []func(string) bool
+	excludes []func(string) bool
+}
+
+func parseNameFilter(expr string) (*nameFilter, error) {
+	f := &nameFilter{
+		expr: strings.TrimSpace(expr),
+	}
+	for _, p := range splitPatterns(expr) {
+		exclude := false
+		if strings.HasPrefix(p, "!") {
+			exclude = true
+			p = p[1:]
+		}
+		m, err := parseNamePattern(p)
+		if err != nil {
+			return nil, err
+		}
+		if exclude {
+			f.excludes = append(f.excludes, m)
+		} else {
+			f.includes = append(f.includes, m)
+		}
+	}
+	return f, nil
+}
+
+// splitPatterns splits the expression by spaces, except spaces in regular
+// expressions, which end with a slash followed by a space or the end.
+func splitPatterns(expr string) []string {
+	isSpace := func(b byte) bool { return b == ' ' || b == '\t' }
+	ps := []string{}
+	for i := 0; i < len(expr); {
+		if isSpace(expr[i]) {
+			i++
+			continue
+		}
+		start := i
+		if j := strings.TrimPrefix(expr[i:], "!"); strings.HasPrefix(j, "/") {
+			re := len(expr) - len(j) // the index of the opening slash
+			for k := re + 1; k < len(expr); k++ {
+				if expr[k] == '/' && (k+1 == len(expr) || isSpace(expr[k+1])) {
+					i = k + 1
+					break
+				}
+			}
+		}
+		for i < len(expr) && !isSpace(expr[i]) {
+			i++
+		}
+		ps = append(ps, expr[start:i])
+	}
+	return ps
+}
+
+func parseNamePattern(p string) (func(string) bool, error) {
+	if len(p) >= 2 && strings.HasPrefix(p, "/") && strings.HasSuffix(p, "/") {
+		re, err := regexp.Compile(p[1 : len(p)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression '%v', %v", p, err)
+		}
+		return re.MatchString, nil
+	}
+	if p == "" {
+		return nil, fmt.Errorf("empty pattern")
+	}
+	if _, err := path.Match(p, ""); err != nil {
+		return nil, fmt.Errorf("invalid glob pattern '%v', %v", p, err)
+	}
+	return func(name string) bool {
+		ok, _ := path.Match(p, name)
+		return ok
+	}, nil
+}
+
+// match returns true when the node of the name is shown. A nil filter shows
+// all nodes.
+func (f *nameFilter) match(name string) bool {
+	if f == nil {
+		return true
+	}
+	return !f.excluded(name) && f.included(name)
+}
+
+// matchEdge returns true when neither the sender nor the receiver is excluded,
+// and either of them is included.
+func (f *nameFilter) matchEdge(l *edgeLine) bool {
+	if f == nil {
+		return true
+	}
+	if f.excluded(l.senderName) || f.excluded(l.receiverName) {
+		return false
+	}
+	return f.included(l.senderName) || f.included(l.receiverName)
+}
+
+func (f *nameFilter) excluded(name string) bool {
+	for _, m := range f.excludes {
+		if m(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *nameFilter) included(name string) bool {
+	if len(f.includes) == 0 {
+		return true
+	}
+	for _, m := range f.includes {
+		if m(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterKeys returns keys of shown lines.
+func (f *nameFilter) filterKeys(keys []string, match func(key string) bool) []string {
+	if f == nil {
+		return keys
+	}
+	filtered := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if match(k) {
+			filtered = append(filtered, k)
+		}
+	}
+	return filtered
+}
+
+// filterStatus returns a message of the current filter, or an empty string
+// when nodes are not filtered.
+func filterStatus(ms *MonitoringState) string {
+	if ms.filter == nil {
+		return ""
+	}
+	return fmt.Sprintf("filter: %v", ms.filter.expr)
+}
+
+func updateFilter(ms *MonitoringState, eb *editBox) (done struct{}) {
+	done = struct{}{}
+	defer eb.reset()
+
+	in, err := eb.start("Filter by name (blank for all) ")
+	if err != nil {
+		eb.redrawAll(err.Error())
+		<-time.After(2 * time.Second)
+		return
+	}
+	if strings.TrimSpace(in) == "" {
+		ms.filter = nil
+		return
+	}
+
+	f, err := parseNameFilter(in)
+	if err != nil {
+		eb.redrawAll(fmt.Sprintf("Invalid filter, %v", err))
+		<-time.After(2 * time.Second)
+		return
+	}
+	ms.filter = f
+	return
+}
@@ -0,0 +1,97 @@
+package iotop
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitPatterns(t *testing.T) {
+	cases := []struct {
+		expr string
+		want []string
+	}{
+		{"", []string{}},
+		{"  a*  !b ", []string{"a*", "!b"}},
+		{"/^in [0-9]+$/ out", []string{"/^in [0-9]+$/", "out"}},
+		{"!/a b/", []string{"!/a b/"}},
+		{"/a/b c/ d", []string{"/a/b c/", "d"}},
+		{"/unterminated x", []string{"/unterminated", "x"}},
+	}
+	for _, c := range cases {
+		if got := splitPatterns(c.expr); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%q: got %q, want %q", c.expr, got, c.want)
+		}
+	}
+}
+
+func TestNameFilterMatch(t *testing.T) {
+	names := []string{"ingest_1", "ingest_2", "filter", "out put", "sink"}
+	cases := []struct {
+		expr string
+		want []string
+	}{
+		{"ingest_*", []string{"ingest_1", "ingest_2"}},
+		{"!ingest_*", []string{"filter", "out put", "sink"}},
+		{"ingest_* !ingest_2", []string{"ingest_1"}},
+		{"ingest_* sink", []string{"ingest_1", "ingest_2", "sink"}},
+		{"/^ingest_[2-9]$/", []string{"ingest_2"}},
+		{"/t p/", []string{"out put"}},
+		{"!/t p/ !/^i/", []string{"filter", "sink"}},
+		{"nothing", []string{}},
+	}
+	for _, c := range cases {
+		f, err := parseNameFilter(c.expr)
+		if err != nil {
+			t.Errorf("%q: unexpected error, %v", c.expr, err)
+			continue
+		}
+		if got := f.filterKeys(names, f.match); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%q: got %q, want %q", c.expr, got, c.want)
+		}
+	}
+
+	var f *nameFilter
+	if got := f.filterKeys(names, f.match); !reflect.DeepEqual(got, names) {
+		t.Errorf("nil filter: got %q, want all", got)
+	}
+}
+
+func TestNameFilterMatchEdge(t *testing.T) {
+	edges := map[string]*edgeLine{
+		"src->box":  {senderName: "src", receiverName: "box"},
+		"box->sink": {senderName: "box", receiverName: "sink"},
+		"src->sink": {senderName: "src", receiverName: "sink"},
+	}
+	keys := edgeLineMap(edges).sortedKeys()
+	cases := []struct {
+		expr string
+		want []string
+	}{
+		{"box", []string{"box->sink", "src->box"}},
+		{"!box", []string{"src->sink"}},
+		{"src !sink", []string{"src->box"}},
+		{"!src !sink", []string{}},
+		{"/^s/", []string{"box->sink", "src->box", "src->sink"}},
+	}
+	for _, c := range cases {
+		f, err := parseNameFilter(c.expr)
+		if err != nil {
+			t.Errorf("%q: unexpected error, %v", c.expr, err)
+			continue
+		}
+		got := f.filterKeys(keys, func(key string) bool {
+			return f.matchEdge(edges[key])
+		})
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%q: got %q, want %q", c.expr, got, c.want)
+		}
+	}
+}
+
+func TestParseNameFilterError(t *testing.T) {
+	for _, expr := range []string{"/(/", "[", "!"} {
+		if _, err := parseNameFilter(expr); err == nil {
+			t.Errorf("%q should be an error", expr)
+		}
+	}
+}
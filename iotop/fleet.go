@@ -0,0 +1,268 @@
+package iotop
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"text/tabwriter"
+)
+
+// fleetCounter is a counter of a node shown in the fleet view, which is
+// shown as a rate when the previous count is known.
+type fleetCounter struct {
+	valid bool // false when the node type does not have the counter
+	count int64
+	rate  float64
+	rated bool
+}
+
+func (c fleetCounter) String() string {
+	switch {
+	case !c.valid:
+		return "-"
+	case c.rated:
+		return fmt.Sprintf("%.2f", c.rate)
+	}
+	return fmt.Sprintf("[%d]", c.count)
+}
+
+// add returns the sum of counters of the same node on different servers,
+// which is a rate only when both of them are rates.
+func (c fleetCounter) add(o fleetCounter) fleetCounter {
+	return fleetCounter{
+		valid: c.valid && o.valid,
+		count: c.count + o.count,
+		rate:  c.rate + o.rate,
+		rated: c.rated && o.rated,
+	}
+}
+
+// fleetNode is I/O of a node on a server, or the total of the node on all
+// servers.
+type fleetNode struct {
+	name     string
+	nodeType string
+	server   string
+	state    string
+	in       fleetCounter
+	out      fleetCounter
+	dropped  int64
+	nerror   int64
+	level    rowLevel
+	tab      int // the index of the tab, meaningless in totals
+
+	disconnected bool // the server is disconnected and statuses are stale
+	unknown      bool // a total without any connected servers
+}
+
+func (n fleetNode) add(o fleetNode) fleetNode {
+	n.in = n.in.add(o.in)
+	n.out = n.out.add(o.out)
+	n.dropped += o.dropped
+	n.nerror += o.nerror
+	if n.state != o.state {
+		n.state = "mixed"
+	}
+	n.level = maxLevel(n.level, o.level)
+	return n
+}
+
+func (n fleetNode) String() string {
+	if n.unknown {
+		return fmt.Sprintf("%v\t%v\t%v\t-\t-\t-\t-\t-", n.name, n.nodeType,
+			n.server)
+	}
+	return fmt.Sprintf("%v\t%v\t%v\t%v\t%v\t%v\t%d\t%d", n.name, n.nodeType,
+		n.server, n.state, n.in, n.out, n.dropped, n.nerror)
+}
+
+// fleetNodes returns I/O of nodes shown in the fleet view.
+func (h *lineHolder) fleetNodes(ms *MonitoringState) []fleetNode {
+	h.rwm.RLock()
+	defer h.rwm.RUnlock()
+	counter := func(cur, prev int64, hasPrev bool) fleetCounter {
+		c := fleetCounter{valid: true, count: cur}
+		if hasPrev && !ms.absFlag {
+			c.rated = true
+			c.rate = h.rate(cur-prev, ms)
+		}
+		return c
+	}
+
+	nodes := []fleetNode{}
+	if !ms.hideSrc {
+		for _, name := range h.sortedSourceKeys(ms) {
+			l := h.srcs[name]
+			prev, ok := h.prev.srcs[name]
+			nodes = append(nodes, fleetNode{name: l.name, nodeType: l.nodeType,
+				server: h.server, state: l.state,
+				out:     counter(l.out, prev.out, ok),
+				dropped: l.dropped, level: h.sourceLevel(name)})
+		}
+	}
+	if !ms.hideBox {
+		for _, name := range h.sortedBoxKeys(ms) {
+			l := h.boxes[name]
+			prev, ok := h.prev.boxes[name]
+			nodes = append(nodes, fleetNode{name: l.name, nodeType: l.nodeType,
+				server: h.server, state: l.state,
+				in:      counter(l.in, prev.in, ok),
+				out:     counter(l.out, prev.out, ok),
+				dropped: l.dropped, nerror: l.nerror, level: h.boxLevel(name)})
+		}
+	}
+	if !ms.hideSink {
+		for _, name := range h.sortedSinkKeys(ms) {
+			l := h.sinks[name]
+			prev, ok := h.prev.sinks[name]
+			nodes = append(nodes, fleetNode{name: l.name, nodeType: l.nodeType,
+				server: h.server, state: l.state,
+				in:     counter(l.in, prev.in, ok),
+				nerror: l.nerror, level: h.sinkLevel(name)})
+		}
+	}
+	return nodes
+}
+
+// sortValue returns the value of the column to sort nodes in the fleet view,
+// where the rate is of tuples sent by sources and boxes, and received by
+// sinks. ok is false when the column is not shown. The value is NaN when it
+// is unknown.
+func (n fleetNode) sortValue(c sortColumn, ms *MonitoringState) (float64,
+	bool) {
+	v := math.NaN()
+	switch c {
+	case sortByRate:
+		r := n.out
+		if !r.valid {
+			r = n.in
+		}
+		switch {
+		case r.rated:
+			v = r.rate
+		case ms.absFlag:
+			v = float64(r.count)
+		}
+	case sortByDropped:
+		v = float64(n.dropped)
+	case sortByErrors:
+		v = float64(n.nerror)
+	default:
+		return 0, false
+	}
+	if n.unknown {
+		return math.NaN(), true
+	}
+	return v, true
+}
+
+// fleetTable returns a table of nodes of the topology on all servers, and
+// the node, the tab and the level of each line of it. Nodes are sorted by
+// node types, and by the column of MonitoringState by their totals on all
+// servers. A node on several servers is followed by the total on them with
+// "*" in the SERVER column. Servers of disconnected streams are marked with
+// '!', and their stale statuses are not added to totals, which are marked
+// with "*!" as partial.
+func fleetTable(ms *MonitoringState, tabs []*monitorTab, tpl string) (string,
+	[]tableRow) {
+	groups := map[string][]fleetNode{} // the same node on servers
+	for i, t := range tabs {
+		if t.lh.topology != tpl {
+			continue
+		}
+		disconnected := t.st.connectionError() != nil
+		for _, n := range t.lh.fleetNodes(ms) {
+			n.tab = i
+			if disconnected {
+				n.server += "!"
+				n.disconnected = true
+			}
+			key := n.nodeType + "|" + n.name
+			groups[key] = append(groups[key], n)
+		}
+	}
+	totals := map[string]fleetNode{}
+	for key, ns := range groups {
+		var total fleetNode
+		connected := 0
+		for _, n := range ns {
+			if n.disconnected {
+				continue
+			}
+			if connected == 0 {
+				total = n
+			} else {
+				total = total.add(n)
+			}
+			connected++
+		}
+		if connected == 0 {
+			total = fleetNode{name: ns[0].name, nodeType: ns[0].nodeType,
+				unknown: true}
+		}
+		total.server = "*"
+		if connected < len(ns) {
+			total.server = "*!"
+		}
+		totals[key] = total
+	}
+
+	b := bytes.NewBuffer(nil)
+	w := tabwriter.NewWriter(b, 0, 0, 1, ' ', 0)
+	rows := []tableRow{{}}
+	fmt.Fprintln(w, "NAME\tNTYPE\tSERVER\tSTATE\tIN\tOUT\tDROP\tERR")
+	for _, sec := range []struct {
+		nodeType string
+		plural   string
+		key      rune // the key to collapse or expand
+		hide     bool
+		collapse bool
+	}{
+		{"source", "sources", '2', ms.hideSrc, ms.collapseSrc},
+		{"box", "boxes", '3', ms.hideBox, ms.collapseBox},
+		{"sink", "sinks", '4', ms.hideSink, ms.collapseSink},
+	} {
+		if sec.hide {
+			continue
+		}
+		keys := []string{}
+		for key, total := range totals {
+			if total.nodeType == sec.nodeType {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		if sec.collapse {
+			fmt.Fprintf(w, "[+] %d %v (%c to expand)\n", len(keys), sec.plural,
+				sec.key)
+			rows = append(rows, tableRow{})
+			continue
+		}
+		keys = sortLineKeys(keys, ms,
+			func(key string, c sortColumn) (float64, bool) {
+				return totals[key].sortValue(c, ms)
+			})
+		for _, key := range keys {
+			for _, n := range groups[key] {
+				fmt.Fprintln(w, n)
+				rows = append(rows, tableRow{node: n.name, level: n.level,
+					tab: n.tab})
+			}
+			if len(groups[key]) > 1 {
+				fmt.Fprintln(w, totals[key])
+				rows = append(rows, tableRow{level: totals[key].level})
+			}
+		}
+	}
+	w.Flush()
+	return b.String(), rows
+}
+
+// fleetStatus returns a message in the fleet view, or an empty string.
+func fleetStatus(ms *MonitoringState) string {
+	if !ms.fleetView || ms.detailNode != "" || ms.eventView {
+		return ""
+	}
+	return "fleet view (F to go back)"
+}
@@ -0,0 +1,63 @@
+package iotop
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestFleetTab(server string, out, prevOut int64,
+	disconnected bool) *monitorTab {
+	lh := newLineHolder()
+	lh.topology = "t"
+	lh.server = server
+	lh.current = time.Unix(10, 0)
+	lh.prev.current = time.Unix(5, 0)
+	gl := &generalLine{name: "src", nodeType: "source", state: "running"}
+	lh.srcs["src"] = sourceLine{generalLine: gl, out: out}
+	lh.prev.srcs["src"] = sourceLine{generalLine: gl, out: prevOut}
+	st := &nodeStatusStream{lh: lh}
+	if disconnected {
+		st.connErr = errors.New("connection refused")
+	}
+	return &monitorTab{lh: lh, st: st}
+}
+
+func TestFleetTableTotal(t *testing.T) {
+	cases := []struct {
+		title string
+		tabs  []*monitorTab
+		total string // the SERVER column and the OUT column of the total
+	}{
+		{"all connected", []*monitorTab{
+			newTestFleetTab("a:1", 100, 50, false),
+			newTestFleetTab("b:2", 200, 100, false),
+		}, "* running - 30.00"},
+		{"partial", []*monitorTab{
+			newTestFleetTab("a:1", 100, 50, false),
+			newTestFleetTab("b:2", 200, 100, true),
+		}, "*! running - 10.00"},
+		{"all disconnected", []*monitorTab{
+			newTestFleetTab("a:1", 100, 50, true),
+			newTestFleetTab("b:2", 200, 100, true),
+		}, "*! - - -"},
+	}
+	for _, c := range cases {
+		ms := &MonitoringState{d: 5 * time.Second, servers: []string{"a", "b"}}
+		s, rows := fleetTable(ms, c.tabs, "t")
+		lines := strings.Split(strings.TrimSpace(s), "\n")
+		if len(lines) != 4 || len(rows) != 4 {
+			t.Errorf("%v: got %d lines and %d rows, want 4\n%v", c.title,
+				len(lines), len(rows), s)
+			continue
+		}
+		total := strings.Join(strings.Fields(lines[3])[2:6], " ")
+		if total != c.total {
+			t.Errorf("%v: got total %q, want %q\n%v", c.title, total, c.total, s)
+		}
+		if rows[3].node != "" {
+			t.Errorf("%v: the total row has the node %q", c.title, rows[3].node)
+		}
+	}
+}
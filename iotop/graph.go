@@ -0,0 +1,133 @@
+package iotop
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// graphStatus returns a message in the graph view, or an empty string.
+func graphStatus(ms *MonitoringState) string {
+	if !ms.graphView || ms.eventView || ms.detailNode != "" {
+		return ""
+	}
+	return "graph view (g to go back)"
+}
+
+// graph returns the topology drawn as trees from nodes without inputs, which
+// are sources in most cases, to sinks on the right. Each arrow is annotated
+// with tuples/sec received through the edge and its queue fill. A node with
+// several inputs is expanded only at the first appearance, and refers to it
+// at others. It also returns the node and the level of each line.
+func (h *lineHolder) graph(ms *MonitoringState) (string, []tableRow) {
+	h.rwm.RLock()
+	defer h.rwm.RUnlock()
+	b := bytes.NewBuffer(nil)
+	rows := []tableRow{}
+
+	outputs := map[string][]*edgeLine{}
+	hasInput := map[string]bool{}
+	nodes := map[string]string{} // node types of nodes
+	for _, key := range edgeLineMap(h.edges).sortedKeys() {
+		l := h.edges[key]
+		if l.senderName == "" || l.receiverName == "" ||
+			!ms.filter.matchEdge(l) {
+			continue
+		}
+		outputs[l.senderName] = append(outputs[l.senderName], l)
+		hasInput[l.receiverName] = true
+		nodes[l.senderName] = l.senderNodeType
+		nodes[l.receiverName] = l.receiverNodeType
+	}
+	for _, name := range sourceLineMap(h.srcs).sortedKeys() {
+		nodes[name] = "source"
+	}
+	for _, name := range boxLineMap(h.boxes).sortedKeys() {
+		nodes[name] = "box"
+	}
+	for _, name := range sinkLineMap(h.sinks).sortedKeys() {
+		nodes[name] = "sink"
+	}
+
+	roots := []string{}
+	for name := range nodes {
+		if !hasInput[name] && (len(outputs[name]) > 0 || ms.filter.match(name)) {
+			roots = append(roots, name)
+		}
+	}
+	// sources first, and then disconnected boxes and sinks
+	sort.Slice(roots, func(i, j int) bool {
+		si, sj := nodes[roots[i]] == "source", nodes[roots[j]] == "source"
+		if si != sj {
+			return si
+		}
+		return roots[i] < roots[j]
+	})
+
+	shown := map[string]bool{}
+	var walk func(name, prefix string)
+	walk = func(name, prefix string) {
+		outs := outputs[name]
+		for i, l := range outs {
+			branch, indent := "├─", "│  "
+			if i == len(outs)-1 {
+				branch, indent = "└─", "   "
+			}
+			label := h.graphNodeLabel(l.receiverName, nodes[l.receiverName])
+			if shown[l.receiverName] && len(outputs[l.receiverName]) > 0 {
+				label += " (see above)"
+			}
+			fmt.Fprintf(b, "%s%s %v ─> %v\n", prefix, branch,
+				h.graphEdgeLabel(l, ms), label)
+			rows = append(rows, tableRow{node: l.receiverName,
+				level: maxLevel(l.level(ms), h.nodeLevel(l.receiverName))})
+			if !shown[l.receiverName] {
+				shown[l.receiverName] = true
+				walk(l.receiverName, prefix+indent)
+			}
+		}
+	}
+	for _, name := range roots {
+		fmt.Fprintln(b, h.graphNodeLabel(name, nodes[name]))
+		rows = append(rows, tableRow{node: name, level: h.nodeLevel(name)})
+		shown[name] = true
+		walk(name, "")
+	}
+	if len(roots) == 0 {
+		fmt.Fprintln(b, "no nodes to show")
+		rows = append(rows, tableRow{})
+	}
+	return b.String(), rows
+}
+
+func (h *lineHolder) graphNodeLabel(name, nodeType string) string {
+	if l, ok := h.findLine(name); ok {
+		return fmt.Sprintf("%v (%v, %v)", name, nodeType, l.state)
+	}
+	return fmt.Sprintf("%v (%v)", name, nodeType)
+}
+
+// graphEdgeLabel returns tuples/sec received through the edge, or the total
+// count when the rate is not shown, and the queue fill.
+func (h *lineHolder) graphEdgeLabel(l *edgeLine, ms *MonitoringState) string {
+	key := fmt.Sprintf("%s|%s", l.senderName, l.receiverName)
+	if prev, ok := h.prev.edges[key]; ok && !ms.absFlag {
+		return fmt.Sprintf("%.2f/s q%3.0f%%", h.rate(l.received-prev.received, ms),
+			l.queueFill()*100)
+	}
+	return fmt.Sprintf("[%d] q%3.0f%%", l.received, l.queueFill()*100)
+}
+
+// nodeLevel returns the level of the node in any node type.
+func (h *lineHolder) nodeLevel(name string) rowLevel {
+	if _, ok := h.srcs[name]; ok {
+		return h.sourceLevel(name)
+	}
+	if _, ok := h.boxes[name]; ok {
+		return h.boxLevel(name)
+	}
+	if _, ok := h.sinks[name]; ok {
+		return h.sinkLevel(name)
+	}
+	return rowNormal
+}
@@ -0,0 +1,107 @@
+package iotop
+
+import (
+	termbox "github.com/nsf/termbox-go"
+)
+
+// rowLevel is a level of attention to a line of tables.
+type rowLevel int
+
+const (
+	rowNormal rowLevel = iota
+	// rowWarning is a line which is a queue filled over the warning threshold
+	// or a node dropping tuples.
+	rowWarning
+	// rowCritical is a line which is a queue filled over the critical
+	// threshold, a node with increasing errors or a node not running.
+	rowCritical
+)
+
+// tableRow is a line of tables.
+type tableRow struct {
+	node  string // the node name, empty when the line is not of a node
+	level rowLevel
+	tab   int // the index of the tab of the node, only in the fleet view
+}
+
+// color returns the foreground color of the line.
+func (r tableRow) color(ms *MonitoringState) termbox.Attribute {
+	if ms.noColor {
+		return iotopTerminalColor
+	}
+	switch r.level {
+	case rowWarning:
+		return termbox.ColorYellow
+	case rowCritical:
+		return termbox.ColorRed
+	}
+	return iotopTerminalColor
+}
+
+// rowColors returns foreground colors of lines.
+func rowColors(rows []tableRow, ms *MonitoringState) []termbox.Attribute {
+	colors := make([]termbox.Attribute, len(rows))
+	for i, r := range rows {
+		colors[i] = r.color(ms)
+	}
+	return colors
+}
+
+func stateLevel(state string) rowLevel {
+	if state != "running" {
+		return rowCritical
+	}
+	return rowNormal
+}
+
+func maxLevel(levels ...rowLevel) rowLevel {
+	max := rowNormal
+	for _, l := range levels {
+		if l > max {
+			max = l
+		}
+	}
+	return max
+}
+
+func (l *edgeLine) level(ms *MonitoringState) rowLevel {
+	switch fill := l.queueFill(); {
+	case fill >= ms.queueCrit:
+		return rowCritical
+	case fill >= ms.queueWarn:
+		return rowWarning
+	}
+	return rowNormal
+}
+
+func (h *lineHolder) sourceLevel(name string) rowLevel {
+	l := h.srcs[name]
+	level := stateLevel(l.state)
+	if prev, ok := h.prev.srcs[name]; ok && l.dropped > prev.dropped {
+		level = maxLevel(level, rowWarning)
+	}
+	return level
+}
+
+func (h *lineHolder) boxLevel(name string) rowLevel {
+	l := h.boxes[name]
+	level := stateLevel(l.state)
+	if prev, ok := h.prev.boxes[name]; ok {
+		if l.dropped > prev.dropped {
+			level = maxLevel(level, rowWarning)
+		}
+		if l.nerror > prev.nerror {
+			level = maxLevel(level, rowCritical)
+		}
+	}
+	return level
+}
+
+func (h *lineHolder) sinkLevel(name string) rowLevel {
+	l := h.sinks[name]
+	level := stateLevel(l.state)
+	if prev, ok := h.prev.sinks[name]; ok && l.nerror > prev.nerror {
+		level = maxLevel(level, rowCritical)
+	}
+	return level
+}
@@ -0,0 +1,116 @@
+package iotop
+
+import (
+	"math"
+)
+
+// rateHistoryLength is the number of refreshes to keep rates of each node and
+// edge.
+const rateHistoryLength = 20
+
+// sparklineWidth is the number of the latest rates shown in sparklines.
+const sparklineWidth = 10
+
+// sparklineBlocks are characters of sparklines from the lowest.
+var sparklineBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// rateHistory is a ring buffer of rates.
+type rateHistory struct {
+	values []float64
+	next   int
+	n      int
+	ewma   []float64 // EWMAs of rates for each smoothing window
+}
+
+func newRateHistory(size int) *rateHistory {
+	return &rateHistory{
+		values: make([]float64, size),
+	}
+}
+
+func (r *rateHistory) add(v float64) {
+	r.values[r.next] = v
+	r.next = (r.next + 1) % len(r.values)
+	if r.n < len(r.values) {
+		r.n++
+	}
+}
+
+// list returns rates from the oldest one.
+func (r *rateHistory) list() []float64 {
+	l := make([]float64, 0, r.n)
+	start := (r.next - r.n + len(r.values)) % len(r.values)
+	for i := 0; i < r.n; i++ {
+		l = append(l, r.values[(start+i)%len(r.values)])
+	}
+	return l
+}
+
+// sparkline returns the trend of the latest rates as bars scaled from the
+// minimum to the maximum of them, or "-" when there is no rate yet.
+func (r *rateHistory) sparkline(width int) string {
+	if r == nil || r.n == 0 {
+		return "-"
+	}
+	l := r.list()
+	if len(l) > width {
+		l = l[len(l)-width:]
+	}
+	min, max := math.Inf(1), math.Inf(-1)
+	for _, v := range l {
+		min = math.Min(min, v)
+		max = math.Max(max, v)
+	}
+	s := make([]rune, len(l))
+	for i, v := range l {
+		n := 0
+		if max > min {
+			n = int((v - min) / (max - min) * float64(len(sparklineBlocks)-1))
+		}
+		s[i] = sparklineBlocks[n]
+	}
+	return string(s)
+}
+
+// recordHistory adds rates of nodes, and tuples/sec received through edges,
+// between the current and the previous statuses to their histories. It is
+// called when all statuses of the current timestamp are pushed.
+func (h *lineHolder) recordHistory() {
+	addTo := func(history map[string]*rateHistory, key string, diff int64) {
+		r, ok := h.elapsedRate(diff)
+		if !ok {
+			return
+		}
+		hist, ok := history[key]
+		if !ok {
+			hist = newRateHistory(rateHistoryLength)
+			history[key] = hist
+		}
+		hist.add(r)
+		hist.addEWMA(r, h.current.Sub(h.prev.current).Seconds(),
+			h.smoothWindows)
+	}
+	add := func(name string, diff int64) {
+		addTo(h.history, name, diff)
+	}
+	for name, l := range h.srcs {
+		if prev, ok := h.prev.srcs[name]; ok {
+			add(name, l.out-prev.out)
+		}
+	}
+	for name, l := range h.boxes {
+		if prev, ok := h.prev.boxes[name]; ok {
+			add(name, l.inOut-prev.inOut)
+		}
+	}
+	for name, l := range h.sinks {
+		if prev, ok := h.prev.sinks[name]; ok {
+			add(name, l.in-prev.in)
+		}
+	}
+	for key, l := range h.edges {
+		if prev, ok := h.prev.edges[key]; ok {
+			addTo(h.edgeHistory, key, l.received-prev.received)
+		}
+	}
+}
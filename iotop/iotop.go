@@ -1,12 +1,11 @@
 package iotop
 
 import (
-	"errors"
 	"fmt"
+	"os"
 	"strings"
 	"time"
 
-	"gopkg.in/sensorbee/sensorbee.v0/data"
 	cli "gopkg.in/urfave/cli.v1"
 
 	"github.com/mattn/go-runewidth"
@@ -15,64 +14,127 @@ import (
 
 // Run 'sensorbee-iotop' command.
 func Run(c *cli.Context) error {
-	// TODO: check os.Stdout().Fd() is terminal or not
-	// ref: github.com/mattn/go-isatty
-
-	req, err := newNodeStatusRequester(c.String("uri"), c.String("api-version"),
-		c.String("topology"))
+	ms, err := SetUpMonitoringState(c)
 	if err != nil {
 		return err
 	}
+	if ms.replayFile != "" {
+		return Replay(ms)
+	}
 
-	ms, err := SetUpMonitoringState(c)
-	if err != nil {
-		return err
+	if !ms.allTopologies && len(ms.topologies) == 0 {
+		tpl, err := discoverTopology(ms)
+		if err != nil {
+			return err
+		}
+		ms.topologies = []string{tpl}
+	}
+	var tpls map[string][]string // topologies on each server with --all
+	if ms.allTopologies {
+		if tpls, ms.topologies, err = listServerTopologies(os.Stderr,
+			ms.servers, ms.apiVersion); err != nil {
+			return err
+		}
 	}
-	return Monitor(ms, req)
+	reqs := []StatusRequester{}
+	for _, uri := range ms.servers {
+		// servers which cannot be listed are monitored for topologies on the
+		// others, which are shown as disconnected until they are reachable
+		names := ms.topologies
+		if l, ok := tpls[uri]; ok {
+			names = l
+		}
+		for _, tpl := range names {
+			req, err := newNodeStatusRequester(uri, ms.apiVersion, tpl)
+			if err != nil {
+				return err
+			}
+			reqs = append(reqs, req)
+		}
+	}
+	if len(reqs) == 0 {
+		return fmt.Errorf("there is no topology on the servers")
+	}
+	return Monitor(ms, reqs...)
 }
 
-// Monitor I/O of each nodes.
-func Monitor(ms *MonitoringState, req StatusRequester) error {
-	if err := setupStatusQuery(req, 1.0); err != nil {
-		return err
+// Monitor I/O of each nodes in topologies of requesters, which are streamed
+// concurrently. Requesters can be of different servers, and when multiple
+// servers are monitored, streams which cannot be started are shown as
+// disconnected and retried instead of returning an error.
+func Monitor(ms *MonitoringState, reqs ...StatusRequester) error {
+	defer ms.alerts.Close()
+	var rec *statusRecorder
+	if ms.recordFile != "" {
+		var err error
+		if rec, err = newStatusRecorder(ms.recordFile); err != nil {
+			return err
+		}
+		defer rec.Close()
 	}
-	defer tearDownStatusQuery(req) //TODO: skip error
-	res, err := selectNodeStatus(req)
-	if err != nil {
-		return err
+
+	tabs := make([]*monitorTab, 0, len(reqs))
+	sts := make([]*nodeStatusStream, 0, len(reqs))
+	defer func() {
+		// streams of tabs can be replaced by switching topologies
+		for _, t := range tabs {
+			if err := t.st.stop(); err != nil {
+				fmt.Fprintf(os.Stderr, "cannot drop the source '%v' of %v, %v\n",
+					t.st.name, t.lh.topology, err)
+			}
+		}
+	}()
+	for _, req := range reqs {
+		cleanUpStaleStatusSources(os.Stderr, req, ms.gcSources)
+
+		lh := newLineHolder()
+		lh.topology = req.Topology()
+		lh.server = serverLabel(req.Server())
+		lh.smoothWindows = ms.smoothWindows
+		st := newNodeStatusStream(req, lh, rec)
+		if len(ms.servers) <= 1 {
+			if err := st.start(ms.d.Seconds()); err != nil {
+				return err
+			}
+		} else if err := st.startOrRetry(ms.d.Seconds()); err != nil {
+			// other servers are monitored while retrying
+			fmt.Fprintf(os.Stderr, "cannot monitor %v on %v, retrying: %v\n",
+				lh.topology, req.Server(), err)
+		}
+		tabs = append(tabs, &monitorTab{lh: lh, st: st})
+		sts = append(sts, st)
 	}
-	defer res.Close()
 
+	errChan := streamsErrorsOrSignal(sts...)
+	if ms.batch {
+		return monitorBatch(os.Stdout, ms, tabs, errChan)
+	}
+	return monitorTerminal(ms, tabs, errChan)
+}
+
+// Replay node I/O recorded in the file of MonitoringState without servers.
+func Replay(ms *MonitoringState) error {
+	defer ms.alerts.Close()
 	lh := newLineHolder()
-	errChan := make(chan error, 1)
-	ch, err := res.ReadStreamJSON()
+	lh.smoothWindows = ms.smoothWindows
+	errChan, err := replayNodeStatus(ms.replayFile, lh, ms.replaySpeed, ms.batch)
 	if err != nil {
 		return err
 	}
-	go func() {
-		for {
-			iv, ok := <-ch
-			if !ok || iv == nil {
-				errChan <- errors.New("monitoring stream is closed")
-				return
-			}
-			v, err := data.NewValue(iv)
-			if err != nil {
-				errChan <- err
-				return
-			}
-			m, err := data.AsMap(v)
-			if err != nil {
-				errChan <- err
-				return
-			}
-			if err := lh.push(m); err != nil {
-				errChan <- err
-				return
-			}
-		}
-	}()
 
+	tabs := []*monitorTab{{lh: lh}}
+	if ms.batch {
+		return monitorBatch(os.Stdout, ms, tabs, errChan)
+	}
+	return monitorTerminal(ms, tabs, errChan)
+}
+
+// monitorTerminal shows node I/O of a tab on terminal UI. Streams are
+// restarted when the interval is changed, and can be nil when there is no
+// server to stream from. While the stream is disconnected, the last snapshot
+// is shown with a banner.
+func monitorTerminal(ms *MonitoringState, tabs []*monitorTab,
+	errChan <-chan error) error {
 	eb := &editBox{}
 
 	// setup termbox after all preparations are done, because initializing
@@ -82,10 +144,43 @@ func Monitor(ms *MonitoringState, req StatusRequester) error {
 	}
 	defer termbox.Close()
 
-	pause := make(chan struct{}, 1)
+	// lines shown in the table view, updated by the drawing goroutine and read
+	// while it is paused.
+	var rows []tableRow
+	// pause is not buffered, so the first send returns only after the drawing
+	// goroutine has finished drawing and stopped, and the state shared with it
+	// can be changed until the second send resumes it.
+	pause := make(chan struct{})
 	go func() {
+		defer stopTabsOnPanic(tabs)
 		for {
-			draw(lh.flush(ms))
+			for _, t := range tabs {
+				ms.alerts.evaluate(t.lh)
+			}
+			lh := ms.currentTab(tabs).lh
+			pane := lh.eventPane(ms)
+			if ms.detailNode != "" {
+				draw(&ms.detailScroll, header(ms, tabs), lh.detail(ms.detailNode),
+					nil, pane)
+			} else if ms.eventView {
+				draw(&ms.eventScroll, header(ms, tabs), lh.eventLines(), nil,
+					nil)
+			} else if ms.fleetView {
+				var lines string
+				lines, rows = fleetTable(ms, tabs, lh.topology)
+				draw(&ms.fleetScroll, header(ms, tabs), lines,
+					rowColors(rows, ms), pane)
+			} else if ms.graphView {
+				var lines string
+				lines, rows = lh.graph(ms)
+				draw(&ms.graphScroll, header(ms, tabs), lines,
+					rowColors(rows, ms), pane)
+			} else {
+				var lines string
+				lines, rows = lh.flushTable(ms)
+				draw(&ms.tableScroll, header(ms, tabs), lines,
+					rowColors(rows, ms), pane)
+			}
 			select {
 			case <-time.After(ms.d):
 			case <-pause:
@@ -109,6 +204,59 @@ func Monitor(ms *MonitoringState, req StatusRequester) error {
 				switch ev.Key {
 				case termbox.KeyCtrlC:
 					running = false
+				case termbox.KeyArrowUp, termbox.KeyArrowDown,
+					termbox.KeyPgup, termbox.KeyPgdn, termbox.KeyHome,
+					termbox.KeyEnd:
+					pause <- struct{}{}
+					_, h := termbox.Size()
+					page := h - 2 // keep a line of the previous page
+					if page < 1 {
+						page = 1
+					}
+					sc := ms.currentScroll()
+					switch ev.Key {
+					case termbox.KeyArrowUp:
+						sc.moveBy(-1)
+					case termbox.KeyArrowDown:
+						sc.moveBy(1)
+					case termbox.KeyPgup:
+						sc.moveBy(-page)
+					case termbox.KeyPgdn:
+						sc.moveBy(page)
+					case termbox.KeyHome:
+						sc.moveToTop()
+					case termbox.KeyEnd:
+						sc.moveToBottom()
+					}
+					pause <- struct{}{}
+				case termbox.KeyEnter:
+					pause <- struct{}{}
+					if ms.detailNode != "" {
+						ms.detailNode = ""
+					} else if c := ms.currentScroll().cursor; c >= 0 &&
+						c < len(rows) && rows[c].node != "" {
+						if ms.fleetView {
+							// show the detail on the server of the line
+							ms.tab = rows[c].tab
+						}
+						ms.detailNode = rows[c].node
+						ms.detailScroll = scrollState{cursor: -1}
+					}
+					pause <- struct{}{}
+				case termbox.KeyTab:
+					if len(tabs) > 1 {
+						pause <- struct{}{}
+						ms.switchTab(tabs, 1)
+						pause <- struct{}{}
+					}
+				case termbox.KeyEsc:
+					pause <- struct{}{}
+					if ms.detailNode != "" {
+						ms.detailNode = ""
+					} else {
+						ms.eventView = false
+					}
+					pause <- struct{}{}
 				default:
 				}
 				switch ev.Ch {
@@ -116,7 +264,49 @@ func Monitor(ms *MonitoringState, req StatusRequester) error {
 					running = false
 				case 'd':
 					pause <- struct{}{}
-					pause <- updateInterval(ms, eb)
+					d := ms.d
+					updateInterval(ms, eb)
+					for _, t := range tabs {
+						if t.st != nil && ms.d != d {
+							t.st.restart(ms.d.Seconds())
+						}
+					}
+					pause <- struct{}{}
+				case 'g':
+					pause <- struct{}{}
+					ms.graphView = !ms.graphView
+					ms.fleetView = false
+					ms.eventView = false
+					ms.detailNode = ""
+					pause <- struct{}{}
+				case 'F':
+					pause <- struct{}{}
+					ms.fleetView = !ms.fleetView
+					ms.graphView = false
+					ms.eventView = false
+					ms.detailNode = ""
+					pause <- struct{}{}
+				case 'e':
+					pause <- struct{}{}
+					ms.eventPane = !ms.eventPane
+					pause <- struct{}{}
+				case 'E':
+					pause <- struct{}{}
+					if ms.eventView = !ms.eventView; ms.eventView {
+						ms.eventScroll.moveToBottom()
+					}
+					ms.detailNode = ""
+					pause <- struct{}{}
+				case 'D':
+					pause <- struct{}{}
+					pause <- dumpDOT(ms, ms.currentTab(tabs).lh, eb)
+				case 'T':
+					pause <- struct{}{}
+					pause <- switchTopology(ms, tabs, eb)
+				case 's':
+					pause <- struct{}{}
+					ms.smoothed = !ms.smoothed
+					pause <- struct{}{}
 				case 'c':
 					pause <- struct{}{}
 					ms.absFlag = !ms.absFlag
@@ -124,8 +314,44 @@ func Monitor(ms *MonitoringState, req StatusRequester) error {
 				case 'u':
 					pause <- struct{}{}
 					pause <- hideNodeLines(ms, eb)
+				case '/':
+					pause <- struct{}{}
+					pause <- updateFilter(ms, eb)
+				case '<', '>', 'R', 'P', 'M', 'N':
+					pause <- struct{}{}
+					switch ev.Ch {
+					case '<':
+						ms.sortColumn = ms.sortColumn.next(-1)
+					case '>':
+						ms.sortColumn = ms.sortColumn.next(1)
+					case 'R':
+						ms.sortReverse = !ms.sortReverse
+					case 'P':
+						ms.sortColumn = sortByRate
+					case 'M':
+						ms.sortColumn = sortByQueue
+					case 'N':
+						ms.sortColumn = sortByName
+					}
+					pause <- struct{}{}
+				case '1', '2', '3', '4':
+					pause <- struct{}{}
+					switch ev.Ch {
+					case '1':
+						ms.collapseEdge = !ms.collapseEdge
+					case '2':
+						ms.collapseSrc = !ms.collapseSrc
+					case '3':
+						ms.collapseBox = !ms.collapseBox
+					case '4':
+						ms.collapseSink = !ms.collapseSink
+					}
+					pause <- struct{}{}
 				default:
 				}
+			case termbox.EventResize:
+				pause <- struct{}{}
+				pause <- struct{}{}
 			case termbox.EventError:
 				return fmt.Errorf("cannot get key events to operate, %v",
 					ev.Err)
@@ -137,10 +363,40 @@ func Monitor(ms *MonitoringState, req StatusRequester) error {
 
 const iotopTerminalColor = termbox.ColorDefault
 
-func draw(lines string) {
+// draw the header on the first row, which is also used by the edit box, and
+// lines below it from the scroll position. The scroll position is shown at
+// the right of the header when some lines are out of the terminal, and the
+// line of the cursor is highlighted. Each line is drawn in the foreground
+// color of the same index, or the default color when colors is short. Lines
+// of the pane are fixed at the bottom.
+func draw(sc *scrollState, header, lines string, colors []termbox.Attribute,
+	pane []string) {
 	termbox.Clear(iotopTerminalColor, iotopTerminalColor)
-	for i, line := range strings.Split(lines, "\n") {
-		tbprint(0, i+1, iotopTerminalColor, iotopTerminalColor, line)
+	w, h := termbox.Size()
+	if len(pane) > h/2 {
+		pane = pane[len(pane)-h/2:]
+	}
+	for i, line := range pane {
+		tbprint(0, h-len(pane)+i, iotopTerminalColor, iotopTerminalColor, line)
+	}
+	visible, pos := sc.visibleLines(
+		strings.Split(strings.TrimRight(lines, "\n"), "\n"), h-1-len(pane))
+	tbprint(0, 0, iotopTerminalColor, iotopTerminalColor, header)
+	if pos != "" {
+		tbprint(w-runewidth.StringWidth(pos), 0, iotopTerminalColor,
+			iotopTerminalColor, pos)
+	}
+	for i, line := range visible {
+		fg := iotopTerminalColor
+		if n := sc.top + i; n < len(colors) {
+			fg = colors[n]
+		}
+		if sc.cursor == sc.top+i {
+			fg |= termbox.AttrReverse
+			fill(0, i+1, w, 1, termbox.Cell{Ch: ' ', Fg: fg,
+				Bg: iotopTerminalColor})
+		}
+		tbprint(0, i+1, fg, iotopTerminalColor, line)
 	}
 	termbox.Flush()
 }
@@ -151,3 +407,29 @@ func tbprint(x, y int, fg, bg termbox.Attribute, msg string) {
 		x += runewidth.RuneWidth(c)
 	}
 }
+
+// header returns messages of the current state shown on the first row.
+func header(ms *MonitoringState, tabs []*monitorTab) string {
+	tab := ms.currentTab(tabs)
+	lh := tab.lh
+	msgs := []string{}
+	for _, m := range []string{tabStatus(ms, tabs), serverStatus(ms, tabs),
+		disconnectedBanner(tab.st), alertStatus(ms),
+		lh.bottleneckStatus(ms), detailStatus(ms), eventStatus(ms),
+		fleetStatus(ms), graphStatus(ms),
+		smoothStatus(ms), sortStatus(ms), filterStatus(ms)} {
+		if m != "" {
+			msgs = append(msgs, m)
+		}
+	}
+	return strings.Join(msgs, " | ")
+}
+
+// disconnectedBanner returns a message while the stream is disconnected, or
+// an empty string.
+func disconnectedBanner(st *nodeStatusStream) string {
+	if err := st.connectionError(); err != nil {
+		return fmt.Sprintf("DISCONNECTED, reconnecting... (%v)", err)
+	}
+	return ""
+}
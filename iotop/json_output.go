@@ -0,0 +1,190 @@
+package iotop
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// jsonSnapshot is a snapshot of node I/O written in JSON output mode. Rates
+// are tuples per second and are null when there is no previous snapshot of
+// the node to compare with. The schema is documented in README.md, keep them
+// consistent.
+type jsonSnapshot struct {
+	Timestamp time.Time        `json:"timestamp"`
+	Topology  string           `json:"topology"`
+	Server    string           `json:"server"`
+	Interval  float64          `json:"interval"`
+	Sources   []jsonSourceLine `json:"sources"`
+	Boxes     []jsonBoxLine    `json:"boxes"`
+	Sinks     []jsonSinkLine   `json:"sinks"`
+	Edges     []jsonEdgeLine   `json:"edges"`
+}
+
+type jsonSourceLine struct {
+	Name     string   `json:"name"`
+	NodeType string   `json:"node_type"`
+	State    string   `json:"state"`
+	Out      int64    `json:"out"`
+	OutRate  *float64 `json:"out_rate"`
+	Dropped  int64    `json:"dropped"`
+}
+
+type jsonBoxLine struct {
+	Name      string   `json:"name"`
+	NodeType  string   `json:"node_type"`
+	State     string   `json:"state"`
+	InOut     int64    `json:"in_out"`
+	InOutRate *float64 `json:"in_out_rate"`
+	Dropped   int64    `json:"dropped"`
+	Errors    int64    `json:"errors"`
+}
+
+type jsonSinkLine struct {
+	Name     string   `json:"name"`
+	NodeType string   `json:"node_type"`
+	State    string   `json:"state"`
+	In       int64    `json:"in"`
+	InRate   *float64 `json:"in_rate"`
+	Errors   int64    `json:"errors"`
+}
+
+type jsonEdgeLine struct {
+	Sender            string   `json:"sender"`
+	SenderNodeType    string   `json:"sender_node_type"`
+	Receiver          string   `json:"receiver"`
+	ReceiverNodeType  string   `json:"receiver_node_type"`
+	SenderQueueSize   int64    `json:"sender_queue_size"`
+	SenderQueued      int64    `json:"sender_queued"`
+	Sent              int64    `json:"sent"`
+	ReceiverQueueSize int64    `json:"receiver_queue_size"`
+	ReceiverQueued    int64    `json:"receiver_queued"`
+	Received          int64    `json:"received"`
+	InOut             int64    `json:"in_out"`
+	InOutRate         *float64 `json:"in_out_rate"`
+}
+
+// flushJSON returns current node I/O as a JSON object in a line. Lines of
+// hidden node types are written as empty arrays to keep the schema stable.
+func (h *lineHolder) flushJSON(ms *MonitoringState) ([]byte, error) {
+	h.rwm.RLock()
+	defer h.rwm.RUnlock()
+	s := &jsonSnapshot{
+		Timestamp: h.current,
+		Topology:  h.topology,
+		Server:    h.server,
+		Interval:  ms.d.Seconds(),
+		Sources:   []jsonSourceLine{},
+		Boxes:     []jsonBoxLine{},
+		Sinks:     []jsonSinkLine{},
+		Edges:     []jsonEdgeLine{},
+	}
+
+	if !ms.hideEdge {
+		for _, name := range edgeLineMap(h.edges).sortedKeys() {
+			l := h.edges[name]
+			if !ms.filter.matchEdge(l) {
+				continue
+			}
+			jl := jsonEdgeLine{
+				Sender:            l.senderName,
+				SenderNodeType:    l.senderNodeType,
+				Receiver:          l.receiverName,
+				ReceiverNodeType:  l.receiverNodeType,
+				SenderQueueSize:   l.senderQueueSize,
+				SenderQueued:      l.senderQueued,
+				Sent:              l.sent,
+				ReceiverQueueSize: l.receiverQueueSize,
+				ReceiverQueued:    l.receiverQueued,
+				Received:          l.received,
+				InOut:             l.inOut,
+			}
+			if prev, ok := h.prev.edges[name]; ok {
+				jl.InOutRate = h.ratePtr(l.inOut-prev.inOut, ms)
+			}
+			s.Edges = append(s.Edges, jl)
+		}
+	}
+	if !ms.hideSrc {
+		for _, name := range sourceLineMap(h.srcs).sortedKeys() {
+			l := h.srcs[name]
+			if !ms.filter.match(l.name) {
+				continue
+			}
+			jl := jsonSourceLine{
+				Name:     l.name,
+				NodeType: l.nodeType,
+				State:    l.state,
+				Out:      l.out,
+				Dropped:  l.dropped,
+			}
+			if prev, ok := h.prev.srcs[name]; ok {
+				jl.OutRate = h.ratePtr(l.out-prev.out, ms)
+			}
+			s.Sources = append(s.Sources, jl)
+		}
+	}
+	if !ms.hideBox {
+		for _, name := range boxLineMap(h.boxes).sortedKeys() {
+			l := h.boxes[name]
+			if !ms.filter.match(l.name) {
+				continue
+			}
+			jl := jsonBoxLine{
+				Name:     l.name,
+				NodeType: l.nodeType,
+				State:    l.state,
+				InOut:    l.inOut,
+				Dropped:  l.dropped,
+				Errors:   l.nerror,
+			}
+			if prev, ok := h.prev.boxes[name]; ok {
+				jl.InOutRate = h.ratePtr(l.inOut-prev.inOut, ms)
+			}
+			s.Boxes = append(s.Boxes, jl)
+		}
+	}
+	if !ms.hideSink {
+		for _, name := range sinkLineMap(h.sinks).sortedKeys() {
+			l := h.sinks[name]
+			if !ms.filter.match(l.name) {
+				continue
+			}
+			jl := jsonSinkLine{
+				Name:     l.name,
+				NodeType: l.nodeType,
+				State:    l.state,
+				In:       l.in,
+				Errors:   l.nerror,
+			}
+			if prev, ok := h.prev.sinks[name]; ok {
+				jl.InRate = h.ratePtr(l.in-prev.in, ms)
+			}
+			s.Sinks = append(s.Sinks, jl)
+		}
+	}
+	return json.Marshal(s)
+}
+
+func (h *lineHolder) ratePtr(diff int64, ms *MonitoringState) *float64 {
+	r := h.rate(diff, ms)
+	return &r
+}
+
+type jsonSnapshotWriter struct {
+	w io.Writer
+}
+
+func (j *jsonSnapshotWriter) writeSnapshot(ms *MonitoringState, lh *lineHolder) error {
+	b, err := lh.flushJSON(ms)
+	if err != nil {
+		return fmt.Errorf("cannot encode a snapshot to JSON, %v", err)
+	}
+	_, err = fmt.Fprintf(j.w, "%s\n", b)
+	return err
+}
+
+func (j *jsonSnapshotWriter) Close() error {
+	return nil
+}
@@ -11,20 +11,75 @@ import (
 )
 
 type prevLineHolder struct {
-	srcs  map[string]sourceLine
-	boxes map[string]boxLine
-	sinks map[string]sinkLine
-	edges map[string]*edgeLine
-}
-
-type lineHolder struct {
-	rwm     sync.RWMutex
 	srcs    map[string]sourceLine
 	boxes   map[string]boxLine
 	sinks   map[string]sinkLine
 	edges   map[string]*edgeLine
 	current time.Time
-	prev    *prevLineHolder // not use lineHolder not to share other parameter
+}
+
+// copy returns a holder with copies of the maps, which can be changed without
+// changing the original.
+func (p *prevLineHolder) copy() *prevLineHolder {
+	c := &prevLineHolder{
+		srcs:    make(map[string]sourceLine, len(p.srcs)),
+		boxes:   make(map[string]boxLine, len(p.boxes)),
+		sinks:   make(map[string]sinkLine, len(p.sinks)),
+		edges:   make(map[string]*edgeLine, len(p.edges)),
+		current: p.current,
+	}
+	for k, v := range p.srcs {
+		c.srcs[k] = v
+	}
+	for k, v := range p.boxes {
+		c.boxes[k] = v
+	}
+	for k, v := range p.sinks {
+		c.sinks[k] = v
+	}
+	for k, v := range p.edges {
+		c.edges[k] = v
+	}
+	return c
+}
+
+// hasNode returns true when the statuses have the node. A nil holder has no
+// nodes.
+func (p *prevLineHolder) hasNode(name string) bool {
+	if p == nil {
+		return false
+	}
+	_, src := p.srcs[name]
+	_, box := p.boxes[name]
+	_, sink := p.sinks[name]
+	return src || box || sink
+}
+
+type lineHolder struct {
+	topology    string // the topology name, empty on replay
+	server      string // the label of the server, empty on replay
+	rwm         sync.RWMutex
+	srcs        map[string]sourceLine
+	boxes       map[string]boxLine
+	sinks       map[string]sinkLine
+	edges       map[string]*edgeLine
+	current     time.Time
+	prev        *prevLineHolder         // not use lineHolder not to share other parameter
+	last        *prevLineHolder         // the last complete statuses, never changed
+	history     map[string]*rateHistory // rates of nodes
+	edgeHistory map[string]*rateHistory // tuples/sec received through edges
+	// windows of EWMAs of rates in histories
+	smoothWindows []time.Duration
+
+	seen         map[string]bool // nodes which have ever been pushed
+	restarts     map[string]int  // the number of restarts of nodes
+	restarted    map[string]bool // nodes restarted in the current statuses
+	stateChanges map[string]stateChange
+
+	events     []event         // from the oldest
+	dropping   map[string]bool // nodes dropped tuples in the current statuses
+	fullQueues map[string]bool // edges with full queues
+
 	decoder *data.Decoder
 }
 
@@ -36,13 +91,22 @@ func newLineHolder() *lineHolder {
 		edges: map[string]*edgeLine{},
 	}
 	return &lineHolder{
-		srcs:    map[string]sourceLine{},
-		boxes:   map[string]boxLine{},
-		sinks:   map[string]sinkLine{},
-		edges:   map[string]*edgeLine{},
-		current: time.Now(),
-		prev:    prev,
-		decoder: data.NewDecoder(nil),
+		srcs:          map[string]sourceLine{},
+		boxes:         map[string]boxLine{},
+		sinks:         map[string]sinkLine{},
+		edges:         map[string]*edgeLine{},
+		current:       time.Now(),
+		prev:          prev,
+		history:       map[string]*rateHistory{},
+		edgeHistory:   map[string]*rateHistory{},
+		smoothWindows: defaultSmoothWindows,
+		seen:          map[string]bool{},
+		restarts:      map[string]int{},
+		restarted:     map[string]bool{},
+		stateChanges:  map[string]stateChange{},
+		dropping:      map[string]bool{},
+		fullQueues:    map[string]bool{},
+		decoder:       data.NewDecoder(nil),
 	}
 }
 
@@ -51,6 +115,30 @@ func (h *lineHolder) clear() { // hand GC to clear old maps
 	h.boxes = map[string]boxLine{}
 	h.sinks = map[string]sinkLine{}
 	h.edges = map[string]*edgeLine{}
+	h.restarted = map[string]bool{}
+}
+
+// forgetRemoved removes histories and state changes of nodes and edges
+// missing from the last complete statuses, not to keep those of removed ones
+// forever. Nodes seen and their restarts are kept for the session to detect
+// nodes reappearing after any period as restarted. The caller must hold the
+// lock.
+func (h *lineHolder) forgetRemoved() {
+	for name := range h.history {
+		if !h.last.hasNode(name) {
+			delete(h.history, name)
+		}
+	}
+	for key := range h.edgeHistory {
+		if _, ok := h.last.edges[key]; !ok {
+			delete(h.edgeHistory, key)
+		}
+	}
+	for name := range h.stateChanges {
+		if !h.last.hasNode(name) {
+			delete(h.stateChanges, name)
+		}
+	}
 }
 
 func (h *lineHolder) push(m data.Map) error {
@@ -62,10 +150,18 @@ func (h *lineHolder) push(m data.Map) error {
 	}
 
 	if h.current != ns.Timestamp {
-		h.prev.srcs = h.srcs
-		h.prev.boxes = h.boxes
-		h.prev.sinks = h.sinks
-		h.prev.edges = h.edges
+		h.recordEvents()
+		h.recordHistory()
+		h.last = &prevLineHolder{
+			srcs:    h.srcs,
+			boxes:   h.boxes,
+			sinks:   h.sinks,
+			edges:   h.edges,
+			current: h.current,
+		}
+		// previous statuses of restarted nodes are removed from the copy
+		h.prev = h.last.copy()
+		h.forgetRemoved()
 		h.clear()
 		h.current = ns.Timestamp
 	}
@@ -74,6 +170,7 @@ func (h *lineHolder) push(m data.Map) error {
 		name:     ns.NodeName,
 		nodeType: ns.NodeType,
 		state:    ns.State,
+		raw:      m,
 	}
 	switch ns.NodeType {
 	case "source":
@@ -82,12 +179,19 @@ func (h *lineHolder) push(m data.Map) error {
 			out:         ns.OutputStats.NumSentTotal,
 			dropped:     ns.OutputStats.NumDropped,
 		}
+		prev, ok := h.prev.srcs[ns.NodeName]
+		if h.checkNodeRestart(ns.NodeName, ns.State, prev.generalLine,
+			ok && (line.out < prev.out || line.dropped < prev.dropped)) {
+			delete(h.prev.srcs, ns.NodeName)
+		}
 		h.srcs[ns.NodeName] = line
 		h.setSourcePipeStatus(ns.NodeName, ns.NodeType, ns.OutputStats.Outputs)
 
 	case "box":
 		line := boxLine{
 			generalLine: gl,
+			in:          ns.InputStats.NumReceivedTotal,
+			out:         ns.OutputStats.NumSentTotal,
 			inOut: ns.OutputStats.NumSentTotal -
 				ns.InputStats.NumReceivedTotal,
 			dropped: ns.OutputStats.NumDropped,
@@ -95,6 +199,12 @@ func (h *lineHolder) push(m data.Map) error {
 		}
 		// TODO: process time
 		// TODO: BQL statement, when SELETE query
+		prev, ok := h.prev.boxes[ns.NodeName]
+		if h.checkNodeRestart(ns.NodeName, ns.State, prev.generalLine,
+			ok && (line.in < prev.in || line.out < prev.out ||
+				line.dropped < prev.dropped || line.nerror < prev.nerror)) {
+			delete(h.prev.boxes, ns.NodeName)
+		}
 		h.boxes[ns.NodeName] = line
 		h.setSourcePipeStatus(ns.NodeName, ns.NodeType, ns.OutputStats.Outputs)
 		h.setDestinationPipeStatus(ns.NodeName, ns.NodeType, ns.InputStats.Inputs)
@@ -105,6 +215,11 @@ func (h *lineHolder) push(m data.Map) error {
 			in:          ns.InputStats.NumReceivedTotal,
 			nerror:      ns.InputStats.NumErrors,
 		}
+		prev, ok := h.prev.sinks[ns.NodeName]
+		if h.checkNodeRestart(ns.NodeName, ns.State, prev.generalLine,
+			ok && (line.in < prev.in || line.nerror < prev.nerror)) {
+			delete(h.prev.sinks, ns.NodeName)
+		}
 		h.sinks[ns.NodeName] = line
 		h.setDestinationPipeStatus(ns.NodeName, ns.NodeType, ns.InputStats.Inputs)
 	}
@@ -123,6 +238,9 @@ func (h *lineHolder) setSourcePipeStatus(name, nodeType string, outputs data.Map
 		}
 
 		key := fmt.Sprintf("%s|%s", name, outName)
+		h.checkEdgeReset(key, name, func(prev *edgeLine) bool {
+			return pipeSts.NumSent < prev.sent
+		})
 		line, ok := h.edges[key]
 		if !ok {
 			line = &edgeLine{}
@@ -151,6 +269,9 @@ func (h *lineHolder) setDestinationPipeStatus(name, nodeType string, inputs data
 		}
 
 		key := fmt.Sprintf("%s|%s", inName, name)
+		h.checkEdgeReset(key, name, func(prev *edgeLine) bool {
+			return pipeSts.NumReceived < prev.received
+		})
 		line, ok := h.edges[key]
 		if !ok {
 			line = &edgeLine{}
@@ -167,100 +288,214 @@ func (h *lineHolder) setDestinationPipeStatus(name, nodeType string, inputs data
 	}
 }
 
+// rate returns the given difference of a counter per second, divided by the
+// elapsed time between "ts" of the current and the previous node statuses.
+// The interval time is used when the elapsed time is unknown.
+func (h *lineHolder) rate(diff int64, ms *MonitoringState) float64 {
+	if r, ok := h.elapsedRate(diff); ok {
+		return r
+	}
+	return float64(diff) / ms.d.Seconds()
+}
+
+// elapsedRate returns the given difference of a counter per second, and
+// false when the elapsed time between the current and the previous node
+// statuses is unknown.
+func (h *lineHolder) elapsedRate(diff int64) (float64, bool) {
+	elapsed := h.current.Sub(h.prev.current).Seconds()
+	if h.prev.current.IsZero() || elapsed <= 0 {
+		return 0, false
+	}
+	return float64(diff) / elapsed, true
+}
+
 func (h *lineHolder) flush(ms *MonitoringState) string {
+	lines, _ := h.flushTable(ms)
+	return lines
+}
+
+// flushTable returns tables of current node I/O, and the node and the level of
+// each line of them.
+func (h *lineHolder) flushTable(ms *MonitoringState) (string, []tableRow) {
 	h.rwm.RLock()
 	defer h.rwm.RUnlock()
 	b := bytes.NewBuffer(nil)
 	w := tabwriter.NewWriter(b, 0, 0, 1, ' ', 0)
+	rows := []tableRow{}
 
 	if !ms.hideEdge {
-		h.printEdgeLines(w, ms)
+		if ms.collapseEdge {
+			fmt.Fprintf(w, "[+] %d edges (1 to expand)\n", len(h.sortedEdgeKeys(ms)))
+			rows = append(rows, tableRow{})
+		} else {
+			rows = append(rows, h.printEdgeLines(w, ms)...)
+		}
 		fmt.Fprintln(w, "")
+		rows = append(rows, tableRow{})
 	}
 	if !ms.hideSrc {
-		h.printSrcLines(w, ms)
+		if ms.collapseSrc {
+			fmt.Fprintf(w, "[+] %d sources (2 to expand)\n", len(h.sortedSourceKeys(ms)))
+			rows = append(rows, tableRow{})
+		} else {
+			rows = append(rows, h.printSrcLines(w, ms)...)
+		}
 		fmt.Fprintln(w, "")
+		rows = append(rows, tableRow{})
 	}
 	if !ms.hideBox {
-		h.printBoxLines(w, ms)
+		if ms.collapseBox {
+			fmt.Fprintf(w, "[+] %d boxes (3 to expand)\n", len(h.sortedBoxKeys(ms)))
+			rows = append(rows, tableRow{})
+		} else {
+			rows = append(rows, h.printBoxLines(w, ms)...)
+		}
 		fmt.Fprintln(w, "")
+		rows = append(rows, tableRow{})
 	}
 	if !ms.hideSink {
-		h.printSinkLines(w, ms)
+		if ms.collapseSink {
+			fmt.Fprintf(w, "[+] %d sinks (4 to expand)\n", len(h.sortedSinkKeys(ms)))
+			rows = append(rows, tableRow{})
+		} else {
+			rows = append(rows, h.printSinkLines(w, ms)...)
+		}
 	}
 
 	w.Flush()
-	return b.String()
+	return b.String(), rows
 }
 
-func (h *lineHolder) printEdgeLines(w *tabwriter.Writer, ms *MonitoringState) {
-	fmt.Fprintln(w, "SENDER\tSTYPE\tRCVER\tRTYPE\tSQSIZE\tSQNUM\tSNUM\tRQSIZE\tRQNUM\tRNUM\tINOUT")
-	for _, name := range edgeLineMap(h.edges).sortedKeys() {
+// printEdgeLines prints the table of edges, and returns each line, which does
+// not have the node.
+func (h *lineHolder) printEdgeLines(w *tabwriter.Writer, ms *MonitoringState) []tableRow {
+	rows := []tableRow{{}}
+	bns := h.bottleneckNodes(ms)
+	fmt.Fprintln(w, "SENDER\tSTYPE\tRCVER\tRTYPE\tSQSIZE\tSQNUM\tSQFILL\tSNUM\tRQSIZE\tRQNUM\tRQFILL\tRNUM\tINOUT\tBACKLOG\tTTF"+smoothedHeader(ms, false)+"\tTREND")
+	for _, name := range h.sortedEdgeKeys(ms) {
 		l := h.edges[name]
 		var values string
 		if prev, ok := h.prev.edges[name]; ok && !ms.absFlag {
-			inout := float64(l.inOut-prev.inOut) / ms.d.Seconds()
-			values = fmt.Sprintf("%v\t%v\t%v\t%v\t%d\t%d\t%d\t%d\t%d\t%d\t%.2f",
+			inout := h.rate(l.inOut-prev.inOut, ms)
+			backlog, ttf := formatQueueTrend(h.queueTrend(name, ms))
+			values = fmt.Sprintf("%v\t%v\t%v\t%v\t%d\t%d\t%v\t%d\t%d\t%d\t%v\t%d\t%.2f\t%v\t%v",
 				l.senderName, l.senderNodeType, l.receiverName,
-				l.receiverNodeType, l.senderQueueSize, l.senderQueued, l.sent,
-				l.receiverQueueSize, l.receiverQueued, l.received, inout)
+				l.receiverNodeType, l.senderQueueSize, l.senderQueued,
+				queueGauge(l.senderQueued, l.senderQueueSize), l.sent,
+				l.receiverQueueSize, l.receiverQueued,
+				queueGauge(l.receiverQueued, l.receiverQueueSize), l.received,
+				inout, backlog, ttf)
 		} else {
-			values = fmt.Sprintf("%v\t%v\t%v\t%v\t%d\t%d\t%d\t%d\t%d\t%d\t[%d]",
+			values = fmt.Sprintf("%v\t%v\t%v\t%v\t%d\t%d\t%v\t%d\t%d\t%d\t%v\t%d\t[%d]\t-\t-",
 				l.senderName, l.senderNodeType, l.receiverName,
-				l.receiverNodeType, l.senderQueueSize, l.senderQueued, l.sent,
-				l.receiverQueueSize, l.receiverQueued, l.received, l.inOut)
+				l.receiverNodeType, l.senderQueueSize, l.senderQueued,
+				queueGauge(l.senderQueued, l.senderQueueSize), l.sent,
+				l.receiverQueueSize, l.receiverQueued,
+				queueGauge(l.receiverQueued, l.receiverQueueSize), l.received,
+				l.inOut)
+		}
+		values += smoothedColumns(h.edgeHistory[name], ms, false)
+		values += "\t" + h.edgeHistory[name].sparkline(sparklineWidth)
+		if h.restarted[l.senderName] || h.restarted[l.receiverName] {
+			values += "\t" + restartMarker
+		}
+		if bns[l.receiverName] {
+			values += "\t" + bottleneckMarker
 		}
 		fmt.Fprintln(w, values)
+		rows = append(rows, tableRow{level: l.level(ms)})
 	}
+	return rows
 }
 
-func (h *lineHolder) printSrcLines(w *tabwriter.Writer, ms *MonitoringState) {
-	fmt.Fprintln(w, "NAME\tNTYPE\tSTATE\tOUT\tDROP")
-	for _, name := range sourceLineMap(h.srcs).sortedKeys() {
+func (h *lineHolder) printSrcLines(w *tabwriter.Writer, ms *MonitoringState) []tableRow {
+	rows := []tableRow{{}}
+	fmt.Fprintln(w, "NAME\tNTYPE\tSTATE\t"+rateHeader("OUT", ms)+"\tDROP\tRST"+
+		smoothedHeader(ms, true)+"\tTREND")
+	for _, name := range h.sortedSourceKeys(ms) {
 		l := h.srcs[name]
 		var values string
 		if prev, ok := h.prev.srcs[name]; ok && !ms.absFlag {
-			out := float64(l.out-prev.out) / ms.d.Seconds()
-			values = fmt.Sprintf("%v\t%v\t%v\t%.2f\t%d",
-				l.name, l.nodeType, l.state, out, l.dropped)
+			out := h.rate(l.out-prev.out, ms)
+			values = fmt.Sprintf("%v\t%v\t%v\t%v\t%d",
+				l.name, l.nodeType, l.state,
+				displayedRate(out, h.history[name], ms), l.dropped)
 		} else {
 			values = fmt.Sprintf("%v\t%v\t%v\t[%d]\t%d",
 				l.name, l.nodeType, l.state, l.out, l.dropped)
 		}
+		values += fmt.Sprintf("\t%d", h.restarts[name])
+		values += smoothedColumns(h.history[name], ms, true)
+		values += "\t" + h.history[name].sparkline(sparklineWidth)
+		if h.restarted[name] {
+			values += "\t" + restartMarker
+		}
 		fmt.Fprintln(w, values)
+		rows = append(rows, tableRow{node: name, level: h.sourceLevel(name)})
 	}
+	return rows
 }
 
-func (h *lineHolder) printBoxLines(w *tabwriter.Writer, ms *MonitoringState) {
-	fmt.Fprintln(w, "NAME\tNTYPE\tSTATE\tINOUT\tDROP\tERR")
-	for _, name := range boxLineMap(h.boxes).sortedKeys() {
+func (h *lineHolder) printBoxLines(w *tabwriter.Writer, ms *MonitoringState) []tableRow {
+	rows := []tableRow{{}}
+	bns := h.bottleneckNodes(ms)
+	fmt.Fprintln(w, "NAME\tNTYPE\tSTATE\t"+rateHeader("INOUT", ms)+"\tDROP\tERR\tRST"+
+		smoothedHeader(ms, true)+"\tTREND")
+	for _, name := range h.sortedBoxKeys(ms) {
 		l := h.boxes[name]
 		var values string
 		if prev, ok := h.prev.boxes[name]; ok && !ms.absFlag {
-			inout := float64(l.inOut-prev.inOut) / ms.d.Seconds()
-			values = fmt.Sprintf("%v\t%v\t%v\t%.2f\t%d\t%d",
-				l.name, l.nodeType, l.state, inout, l.dropped, l.nerror)
+			inout := h.rate(l.inOut-prev.inOut, ms)
+			values = fmt.Sprintf("%v\t%v\t%v\t%v\t%d\t%d",
+				l.name, l.nodeType, l.state,
+				displayedRate(inout, h.history[name], ms), l.dropped, l.nerror)
 		} else {
 			values = fmt.Sprintf("%v\t%v\t%v\t[%d]\t%d\t%d",
 				l.name, l.nodeType, l.state, l.inOut, l.dropped, l.nerror)
 		}
+		values += fmt.Sprintf("\t%d", h.restarts[name])
+		values += smoothedColumns(h.history[name], ms, true)
+		values += "\t" + h.history[name].sparkline(sparklineWidth)
+		if h.restarted[name] {
+			values += "\t" + restartMarker
+		}
+		if bns[name] {
+			values += "\t" + bottleneckMarker
+		}
 		fmt.Fprintln(w, values)
+		rows = append(rows, tableRow{node: name, level: h.boxLevel(name)})
 	}
+	return rows
 }
 
-func (h *lineHolder) printSinkLines(w *tabwriter.Writer, ms *MonitoringState) {
-	fmt.Fprintln(w, "NAME\tNTYPE\tSTATE\tIN\tERR")
-	for _, name := range sinkLineMap(h.sinks).sortedKeys() {
+func (h *lineHolder) printSinkLines(w *tabwriter.Writer, ms *MonitoringState) []tableRow {
+	rows := []tableRow{{}}
+	bns := h.bottleneckNodes(ms)
+	fmt.Fprintln(w, "NAME\tNTYPE\tSTATE\t"+rateHeader("IN", ms)+"\tERR\tRST"+
+		smoothedHeader(ms, true)+"\tTREND")
+	for _, name := range h.sortedSinkKeys(ms) {
 		l := h.sinks[name]
 		var values string
 		if prev, ok := h.prev.sinks[name]; ok && !ms.absFlag {
-			in := float64(l.in-prev.in) / ms.d.Seconds()
-			values = fmt.Sprintf("%v\t%v\t%v\t%.2f\t%d",
-				l.name, l.nodeType, l.state, in, l.nerror)
+			in := h.rate(l.in-prev.in, ms)
+			values = fmt.Sprintf("%v\t%v\t%v\t%v\t%d",
+				l.name, l.nodeType, l.state,
+				displayedRate(in, h.history[name], ms), l.nerror)
 		} else {
 			values = fmt.Sprintf("%v\t%v\t%v\t[%d]\t%d",
 				l.name, l.nodeType, l.state, l.in, l.nerror)
 		}
+		values += fmt.Sprintf("\t%d", h.restarts[name])
+		values += smoothedColumns(h.history[name], ms, true)
+		values += "\t" + h.history[name].sparkline(sparklineWidth)
+		if h.restarted[name] {
+			values += "\t" + restartMarker
+		}
+		if bns[name] {
+			values += "\t" + bottleneckMarker
+		}
 		fmt.Fprintln(w, values)
+		rows = append(rows, tableRow{node: name, level: h.sinkLevel(name)})
 	}
+	return rows
 }
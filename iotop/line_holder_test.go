@@ -0,0 +1,59 @@
+package iotop
+
+import "testing"
+
+// newTestStatuses returns statuses which have boxes of the names.
+func newTestStatuses(names ...string) *prevLineHolder {
+	p := &prevLineHolder{
+		srcs:  map[string]sourceLine{},
+		boxes: map[string]boxLine{},
+		sinks: map[string]sinkLine{},
+		edges: map[string]*edgeLine{},
+	}
+	for _, n := range names {
+		p.boxes[n] = boxLine{generalLine: &generalLine{name: n,
+			nodeType: "box", state: "running"}}
+	}
+	return p
+}
+
+func TestLineHolderForgetRemoved(t *testing.T) {
+	h := newLineHolder()
+	for _, n := range []string{"kept", "removed"} {
+		h.history[n] = newRateHistory(rateHistoryLength)
+		h.edgeHistory[n+"->"+n] = newRateHistory(rateHistoryLength)
+		h.stateChanges[n] = stateChange{from: "paused", to: "running"}
+		h.seen[n] = true
+		h.restarts[n] = 1
+	}
+	h.last = newTestStatuses("kept")
+	h.last.edges["kept->kept"] = &edgeLine{senderName: "kept",
+		receiverName: "kept"}
+	h.forgetRemoved()
+
+	cases := []struct {
+		name string
+		kept bool
+	}{
+		{"kept", true},
+		{"removed", false},
+	}
+	for _, c := range cases {
+		if _, ok := h.history[c.name]; ok != c.kept {
+			t.Errorf("%v: history is kept (%v), want %v", c.name, ok, c.kept)
+		}
+		key := c.name + "->" + c.name
+		if _, ok := h.edgeHistory[key]; ok != c.kept {
+			t.Errorf("%v: history is kept (%v), want %v", key, ok, c.kept)
+		}
+		if _, ok := h.stateChanges[c.name]; ok != c.kept {
+			t.Errorf("%v: state change is kept (%v), want %v", c.name, ok,
+				c.kept)
+		}
+		// restarts are counted for the session
+		if !h.seen[c.name] || h.restarts[c.name] != 1 {
+			t.Errorf("%v: seen is %v and restarts are %d, want true and 1",
+				c.name, h.seen[c.name], h.restarts[c.name])
+		}
+	}
+}
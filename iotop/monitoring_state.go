@@ -3,20 +3,68 @@ package iotop
 import (
 	"errors"
 	"fmt"
+	"os"
 	"strings"
 	"time"
 
 	cli "gopkg.in/urfave/cli.v1"
+
+	"github.com/mattn/go-isatty"
 )
 
 // MonitoringState is a global configuration on monitoring edge node I/O status.
 type MonitoringState struct {
+	servers       []string // addresses of SensorBee servers
+	apiVersion    string
+	topologies    []string
+	allTopologies bool // monitor all topologies on the servers
+	tab           int  // the index of the tab shown in terminal UI
+
 	d        time.Duration
 	absFlag  bool
 	hideEdge bool
 	hideSrc  bool
 	hideBox  bool
 	hideSink bool
+
+	sortColumn  sortColumn
+	sortReverse bool
+	filter      *nameFilter // nil shows all nodes
+
+	tableScroll  scrollState
+	detailScroll scrollState
+	detailNode   string // the node shown in the detail view, or empty
+	graphView    bool
+	graphScroll  scrollState
+	fleetView    bool // show nodes on all servers instead of tables
+	fleetScroll  scrollState
+	eventView    bool // show all events instead of tables
+	eventScroll  scrollState
+	eventPane    bool // show the latest events at the bottom
+	collapseEdge bool
+	collapseSrc  bool
+	collapseBox  bool
+	collapseSink bool
+
+	smoothed      bool // show smoothed rates in addition
+	smoothWindows []time.Duration
+
+	queueWarn float64 // ratio of queued tuples to highlight as warning
+	queueCrit float64 // ratio of queued tuples to highlight as critical
+	noColor   bool
+
+	alerts *alerter // nil when no alert rules are given
+
+	batch      bool
+	iterations int    // the number of refreshes in batch mode, 0 is unlimited
+	output     string // output format in batch mode
+	csvDir     string // directory to write CSV files, stdout when empty
+
+	recordFile  string
+	replayFile  string
+	replaySpeed float64
+
+	gcSources bool
 }
 
 // SetUpMonitoringState sets up each configuration parameters.
@@ -27,17 +75,132 @@ func SetUpMonitoringState(c *cli.Context) (*MonitoringState, error) {
 	}
 
 	absFlag := c.Bool("c")
+	n := c.Int("n")
+	if n < 0 {
+		return nil, fmt.Errorf("the number of iterations must not be negative")
+	}
+	output := c.String("output")
+	csvDir := c.String("csv-dir")
+	if csvDir != "" && !c.IsSet("output") {
+		output = "csv"
+	}
+	switch output {
+	case "text", "json", "csv", "dot":
+	default:
+		return nil, fmt.Errorf("invalid output format ('%v')", output)
+	}
+	if csvDir != "" && output != "csv" {
+		return nil, fmt.Errorf("CSV directory is only available on CSV output")
+	}
+	if output == "dot" && !c.IsSet("n") {
+		// write graphs once instead of streaming them forever
+		n = 1
+	}
+	sc, err := parseSortColumn(c.String("sort"))
+	if err != nil {
+		return nil, err
+	}
+	var filter *nameFilter
+	if expr := c.String("filter"); strings.TrimSpace(expr) != "" {
+		if filter, err = parseNameFilter(expr); err != nil {
+			return nil, fmt.Errorf("invalid filter, %v", err)
+		}
+	}
+	queueWarn := c.Float64("queue-warn")
+	queueCrit := c.Float64("queue-crit")
+	if queueWarn <= 0 || queueCrit > 100 || queueWarn > queueCrit {
+		return nil, fmt.Errorf("queue thresholds must be 0 < --queue-warn <= " +
+			"--queue-crit <= 100 [%%]")
+	}
+	smoothWindows, err := parseSmoothWindows(c.String("smooth-windows"))
+	if err != nil {
+		return nil, err
+	}
+	servers, err := parseServers(c.String("uri"), c.IsSet("uri"),
+		c.String("uri-file"))
+	if err != nil {
+		return nil, err
+	}
+	topologies := splitList(c.String("topology"))
+	allTopologies := c.Bool("all")
+	if allTopologies && len(topologies) > 0 {
+		return nil, fmt.Errorf("cannot specify topologies with --all")
+	}
+	recordFile := c.String("record")
+	replayFile := c.String("replay")
+	if recordFile != "" && replayFile != "" {
+		return nil, fmt.Errorf("cannot record and replay at the same time")
+	}
+	if recordFile != "" && (allTopologies || len(topologies) > 1) {
+		return nil, fmt.Errorf("cannot record multiple topologies")
+	}
+	if recordFile != "" && len(servers) > 1 {
+		return nil, fmt.Errorf("cannot record multiple servers")
+	}
+	replaySpeed := c.Float64("replay-speed")
+	if replaySpeed <= 0 {
+		return nil, fmt.Errorf("replay speed must be positive")
+	}
+
+	batch := c.Bool("batch") || output != "text" ||
+		!isatty.IsTerminal(os.Stdout.Fd())
 	ms := &MonitoringState{
-		d:       time.Duration(d*1000) * time.Millisecond,
-		absFlag: absFlag,
+		servers:       servers,
+		apiVersion:    c.String("api-version"),
+		topologies:    topologies,
+		allTopologies: allTopologies,
+
+		d:          time.Duration(d*1000) * time.Millisecond,
+		absFlag:    absFlag,
+		batch:      batch,
+		iterations: n,
+		output:     output,
+		csvDir:     csvDir,
+
+		sortColumn:  sc,
+		sortReverse: c.Bool("sort-reverse"),
+		filter:      filter,
+
+		eventScroll: scrollState{cursor: -1},
+		eventPane:   c.Bool("events"),
+
+		smoothed:      c.Bool("smoothed"),
+		smoothWindows: smoothWindows,
+
+		queueWarn: queueWarn / 100,
+		queueCrit: queueCrit / 100,
+		noColor:   c.Bool("no-color"),
+
+		recordFile:  recordFile,
+		replayFile:  replayFile,
+		replaySpeed: replaySpeed,
+
+		gcSources: c.Bool("gc-sources"),
 	}
 	if err := ms.setUpHideNodeLines(c.String("u")); err != nil {
 		return nil, fmt.Errorf("invalid node name ('%v')", err)
 	}
+	if fn := c.String("alert-rules"); fn != "" {
+		if ms.alerts, err = loadAlertRules(fn); err != nil {
+			return nil, fmt.Errorf("invalid alert rules, %v", err)
+		}
+	}
 
 	return ms, nil
 }
 
+// splitList returns non-empty items separated by commas, like topologies and
+// server addresses.
+func splitList(s string) []string {
+	items := []string{}
+	for _, i := range strings.Split(s, ",") {
+		if i = strings.TrimSpace(i); i != "" {
+			items = append(items, i)
+		}
+	}
+	return items
+}
+
 func (ms *MonitoringState) setUpHideNodeLines(visNode string) error {
 	if visNode == "" {
 		return nil
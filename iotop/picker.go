@@ -0,0 +1,156 @@
+package iotop
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	termbox "github.com/nsf/termbox-go"
+)
+
+// maxListedCandidates is the max number of topologies listed in the prompt of
+// the picker.
+const maxListedCandidates = 5
+
+// discoverTopology returns the topology to monitor when it is not specified.
+// The only topology on the servers is picked automatically, and a topology is
+// asked by the picker when there are several of them on terminal UI.
+func discoverTopology(ms *MonitoringState) (string, error) {
+	_, names, err := listServerTopologies(os.Stderr, ms.servers, ms.apiVersion)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case len(names) == 0:
+		return "", fmt.Errorf("there is no topology on the servers")
+	case len(names) == 1:
+		return names[0], nil
+	case ms.batch:
+		return "", fmt.Errorf(
+			"topology must be specified by --topology or --all, one of %v",
+			strings.Join(names, ", "))
+	}
+
+	if err := termbox.Init(); err != nil {
+		return "", fmt.Errorf("fail to initialize termbox, %v", err)
+	}
+	defer termbox.Close()
+	termbox.Clear(iotopTerminalColor, iotopTerminalColor)
+	tpl, err := pickTopology(&editBox{}, names)
+	if err != nil {
+		return "", err
+	}
+	if tpl == "" {
+		return "", fmt.Errorf("no topology is selected")
+	}
+	return tpl, nil
+}
+
+// pickTopology asks one of the topologies, which is completed by Tab key.
+// It returns an empty string when canceled by Esc or an empty input.
+// termbox must be initialized.
+func pickTopology(eb *editBox, names []string) (string, error) {
+	prefix := "Topology (Tab to complete) "
+	if len(names) <= maxListedCandidates {
+		prefix = fmt.Sprintf("Topology (%v) ", strings.Join(names, ", "))
+	}
+	for {
+		eb.candidates = names
+		in, err := eb.start(prefix)
+		if err != nil {
+			return "", err
+		}
+		in = strings.TrimSpace(in)
+		if in == "" {
+			return "", nil
+		}
+		for _, n := range names {
+			if n == in {
+				return in, nil
+			}
+		}
+		prefix = fmt.Sprintf("No topology '%v', try again (Tab to complete) ",
+			in)
+	}
+}
+
+// switchTopology asks a topology on the server of the current tab, and
+// replaces the stream of the tab with the one of the topology. The previous
+// stream is kept when the new one cannot be started. It must be called while
+// the drawing goroutine is paused, which reads tabs.
+func switchTopology(ms *MonitoringState, tabs []*monitorTab,
+	eb *editBox) (done struct{}) {
+	done = struct{}{}
+	defer eb.reset()
+
+	t := ms.currentTab(tabs)
+	if t.st == nil {
+		eb.redrawAll("Cannot switch topology on replay")
+		<-time.After(2 * time.Second)
+		return
+	}
+	if t.st.rec != nil {
+		eb.redrawAll("Cannot switch topology while recording")
+		<-time.After(2 * time.Second)
+		return
+	}
+	names, err := listTopologies(t.st.req.Server(), ms.apiVersion)
+	if err != nil {
+		eb.redrawAll(fmt.Sprintf("Cannot list topologies, %v", err))
+		<-time.After(2 * time.Second)
+		return
+	}
+	tpl, err := pickTopology(eb, names)
+	if err != nil {
+		eb.redrawAll(err.Error())
+		<-time.After(2 * time.Second)
+		return
+	}
+	if tpl == "" || tpl == t.lh.topology {
+		return
+	}
+
+	prev, err := ms.replaceTabTopology(t, tpl)
+	if err != nil {
+		eb.redrawAll(fmt.Sprintf("Cannot monitor '%v', %v", tpl, err))
+		<-time.After(2 * time.Second)
+		return
+	}
+	if err := prev.stop(); err != nil {
+		eb.redrawAll(fmt.Sprintf("Cannot drop the source '%v', %v", prev.name,
+			err))
+		<-time.After(2 * time.Second)
+	}
+	ms.alerts.forget(prev.lh)
+	ms.topologies = tabTopologies(tabs)
+	ms.tableScroll = scrollState{}
+	ms.graphScroll = scrollState{}
+	ms.fleetScroll = scrollState{}
+	ms.detailNode = ""
+	return
+}
+
+// replaceTabTopology starts a stream of the topology on the server of the tab,
+// and returns the previous stream, which must be stopped by the caller.
+// Errors of the new stream are sent to errChan of the previous stream, which
+// is already merged into errors of monitoring.
+func (ms *MonitoringState) replaceTabTopology(t *monitorTab,
+	tpl string) (*nodeStatusStream, error) {
+	req, err := newNodeStatusRequester(t.st.req.Server(), ms.apiVersion, tpl)
+	if err != nil {
+		return nil, err
+	}
+	lh := newLineHolder()
+	lh.topology = tpl
+	lh.server = t.lh.server
+	lh.smoothWindows = ms.smoothWindows
+	st := newNodeStatusStream(req, lh, nil)
+	st.errChan = t.st.errChan
+	if err := st.start(ms.d.Seconds()); err != nil {
+		return nil, err
+	}
+	prev := t.st
+	t.lh, t.st = lh, st
+	return prev, nil
+}
@@ -0,0 +1,78 @@
+package iotop
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// queueGaugeWidth is the number of characters of a queue fill gauge.
+const queueGaugeWidth = 10
+
+// queueGauge returns a gauge of the queue fill like "[###.......] 30%", or
+// "-" when the size of the queue is unknown.
+func queueGauge(queued, size int64) string {
+	if size <= 0 {
+		return "-"
+	}
+	fill := float64(queued) / float64(size)
+	if fill > 1 {
+		fill = 1
+	} else if fill < 0 {
+		fill = 0
+	}
+	n := int(fill*queueGaugeWidth + 0.5)
+	return fmt.Sprintf("[%s%s] %3.0f%%", strings.Repeat("#", n),
+		strings.Repeat(".", queueGaugeWidth-n), fill*100)
+}
+
+// queueTrend returns the growth of queued tuples of the sender and the
+// receiver per second, and the estimated time until either queue is full. ttf
+// is negative when no queue is growing. ok is false when the edge does not
+// have the previous status.
+func (h *lineHolder) queueTrend(key string, ms *MonitoringState) (
+	growth float64, ttf time.Duration, ok bool) {
+	l := h.edges[key]
+	prev, ok := h.prev.edges[key]
+	if !ok {
+		return 0, -1, false
+	}
+	ttf = -1
+	for _, q := range []struct {
+		queued, prevQueued, size int64
+	}{
+		{l.senderQueued, prev.senderQueued, l.senderQueueSize},
+		{l.receiverQueued, prev.receiverQueued, l.receiverQueueSize},
+	} {
+		g := h.rate(q.queued-q.prevQueued, ms)
+		growth += g
+		if g <= 0 || q.size <= 0 {
+			continue
+		}
+		left := float64(q.size - q.queued)
+		if left < 0 {
+			left = 0
+		}
+		t := time.Duration(left / g * float64(time.Second))
+		if ttf < 0 || t < ttf {
+			ttf = t
+		}
+	}
+	return growth, ttf, true
+}
+
+// formatQueueTrend returns the backlog growth and the time until full shown
+// in the edge table.
+func formatQueueTrend(growth float64, ttf time.Duration, ok bool) (string, string) {
+	if !ok {
+		return "-", "-"
+	}
+	switch {
+	case ttf < 0:
+		return fmt.Sprintf("%+.2f", growth), "-"
+	case ttf == 0:
+		return fmt.Sprintf("%+.2f", growth), "full"
+	default:
+		return fmt.Sprintf("%+.2f", growth), ttf.Round(time.Second).String()
+	}
+}
@@ -0,0 +1,128 @@
+package iotop
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+)
+
+// statusRecorder writes raw node statuses to a gzip compressed file, one JSON
+// object per line.
+type statusRecorder struct {
+	m      sync.Mutex
+	f      *os.File
+	zw     *gzip.Writer
+	enc    *json.Encoder
+	closed bool
+}
+
+func newStatusRecorder(fn string) (*statusRecorder, error) {
+	f, err := os.Create(fn)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create a record file, %v", err)
+	}
+	zw := gzip.NewWriter(f)
+	return &statusRecorder{
+		f:   f,
+		zw:  zw,
+		enc: json.NewEncoder(zw),
+	}, nil
+}
+
+// record writes a node status. The status is flushed on each call not to
+// lose it when iotop is killed.
+func (r *statusRecorder) record(v interface{}) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if r.closed {
+		return nil
+	}
+	if err := r.enc.Encode(v); err != nil {
+		return fmt.Errorf("cannot record a node status, %v", err)
+	}
+	return r.zw.Flush()
+}
+
+func (r *statusRecorder) Close() error {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	if err := r.zw.Close(); err != nil {
+		r.f.Close()
+		return err
+	}
+	return r.f.Close()
+}
+
+var errReplayFinished = errors.New("replay is finished")
+
+// replayNodeStatus pushes node statuses recorded in the file to lh in
+// background, waiting for differences of their "ts" divided by speed. When
+// notifyEnd is true, errReplayFinished is sent to the returned channel after
+// all statuses are pushed.
+func replayNodeStatus(fn string, lh *lineHolder, speed float64,
+	notifyEnd bool) (<-chan error, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open a record file, %v", err)
+	}
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("cannot read a record file, %v", err)
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		defer f.Close()
+		dec := json.NewDecoder(zr)
+		var prevTs time.Time
+		for {
+			var iv interface{}
+			if err := dec.Decode(&iv); err != nil {
+				// a record file is truncated when iotop is killed in
+				// recording, read statuses until then.
+				if err != io.EOF && err != io.ErrUnexpectedEOF {
+					errChan <- fmt.Errorf("cannot read a record file, %v", err)
+				} else if notifyEnd {
+					errChan <- errReplayFinished
+				}
+				return
+			}
+			v, err := data.NewValue(iv)
+			if err != nil {
+				errChan <- err
+				return
+			}
+			m, err := data.AsMap(v)
+			if err != nil {
+				errChan <- err
+				return
+			}
+			ts, err := data.ToTimestamp(m["ts"])
+			if err != nil {
+				errChan <- fmt.Errorf("invalid timestamp in a record file, %v", err)
+				return
+			}
+			if !prevTs.IsZero() && ts.After(prevTs) {
+				time.Sleep(time.Duration(float64(ts.Sub(prevTs)) / speed))
+			}
+			prevTs = ts
+			if err := lh.push(m); err != nil {
+				errChan <- err
+				return
+			}
+		}
+	}()
+	return errChan, nil
+}
@@ -0,0 +1,52 @@
+package iotop
+
+import (
+	"fmt"
+	"time"
+)
+
+// restartMarker is appended to lines of nodes restarted since the previous
+// statuses.
+const restartMarker = "<- RESTARTED"
+
+// stateChange is the last transition of the state of a node.
+type stateChange struct {
+	from string
+	to   string
+	ts   time.Time
+}
+
+func (c stateChange) String() string {
+	return fmt.Sprintf("%v -> %v at %v", c.from, c.to, c.ts.Format(time.RFC3339))
+}
+
+// checkNodeRestart is called on pushing the status of the node, and returns
+// true when the node is restarted since the previous statuses. A node is
+// restarted when its counters are reset, or it reappears after missing from
+// the previous statuses. prev is nil when the node is not in the previous
+// statuses. The caller must hold the lock, and must remove the previous
+// status of the restarted node not to compute rates from reset counters.
+func (h *lineHolder) checkNodeRestart(name, state string, prev *generalLine,
+	reset bool) bool {
+	restarted := reset || (prev == nil && h.seen[name])
+	h.seen[name] = true
+	if prev != nil && prev.state != state {
+		h.stateChanges[name] = stateChange{from: prev.state, to: state,
+			ts: h.current}
+	}
+	if restarted {
+		h.restarts[name]++
+		h.restarted[name] = true
+	}
+	return restarted
+}
+
+// checkEdgeReset removes the previous status of the edge when the counters
+// are reset or either node of the edge is restarted. The caller must hold the
+// lock.
+func (h *lineHolder) checkEdgeReset(key, name string, reset func(prev *edgeLine) bool) {
+	prev, ok := h.prev.edges[key]
+	if ok && (h.restarted[name] || reset(prev)) {
+		delete(h.prev.edges, key)
+	}
+}
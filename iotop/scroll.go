@@ -0,0 +1,100 @@
+package iotop
+
+import (
+	"fmt"
+	"math"
+)
+
+// scrollState is a scroll position of lines in terminal, with a cursor to
+// select a line. When cursor is negative, lines are not selectable and keys
+// only scroll them.
+type scrollState struct {
+	top    int // the first visible line
+	cursor int
+}
+
+// moveBy moves the cursor, or scrolls when lines are not selectable, by n
+// lines. The position is clamped to the number of lines on drawing.
+func (s *scrollState) moveBy(n int) {
+	if s.cursor < 0 {
+		s.top += n
+		if s.top < 0 {
+			s.top = 0
+		}
+		return
+	}
+	s.cursor += n
+	if s.cursor < 0 {
+		s.cursor = 0
+	}
+}
+
+func (s *scrollState) moveToTop() {
+	s.top = 0
+	if s.cursor > 0 {
+		s.cursor = 0
+	}
+}
+
+func (s *scrollState) moveToBottom() {
+	s.top = math.MaxInt32
+	if s.cursor >= 0 {
+		s.cursor = math.MaxInt32
+	}
+}
+
+// visibleLines returns lines visible in the height from the scroll position,
+// and a position indicator like "lines 1-40/300", which is empty when all
+// lines are visible. The position is clamped not to scroll out the last line,
+// and to show the cursor.
+func (s *scrollState) visibleLines(lines []string, height int) ([]string,
+	string) {
+	if height < 1 {
+		return nil, ""
+	}
+	if s.cursor >= 0 {
+		if s.cursor >= len(lines) && len(lines) > 0 {
+			s.cursor = len(lines) - 1
+		}
+		if s.cursor < s.top {
+			s.top = s.cursor
+		}
+		if s.cursor >= s.top+height {
+			s.top = s.cursor - height + 1
+		}
+	}
+	max := len(lines) - height
+	if max < 0 {
+		max = 0
+	}
+	if s.top > max {
+		s.top = max
+	}
+	if s.top < 0 {
+		s.top = 0
+	}
+	end := s.top + height
+	if end > len(lines) {
+		end = len(lines)
+	}
+	if len(lines) <= height {
+		return lines, ""
+	}
+	return lines[s.top:end], fmt.Sprintf("lines %d-%d/%d", s.top+1, end,
+		len(lines))
+}
+
+// currentScroll returns the scroll position of the current view.
+func (ms *MonitoringState) currentScroll() *scrollState {
+	switch {
+	case ms.detailNode != "":
+		return &ms.detailScroll
+	case ms.eventView:
+		return &ms.eventScroll
+	case ms.fleetView:
+		return &ms.fleetScroll
+	case ms.graphView:
+		return &ms.graphScroll
+	}
+	return &ms.tableScroll
+}
@@ -0,0 +1,140 @@
+package iotop
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+)
+
+// parseServers returns addresses of servers given by --uri separated by
+// commas, and listed in the file of --uri-file. The addresses of --uri are
+// ignored when it is not set explicitly and the file is given, not to
+// monitor the default server in addition.
+func parseServers(uris string, urisSet bool, fn string) ([]string, error) {
+	servers := []string{}
+	if urisSet || fn == "" {
+		servers = append(servers, splitList(uris)...)
+	}
+	if fn != "" {
+		l, err := readServerFile(fn)
+		if err != nil {
+			return nil, err
+		}
+		servers = append(servers, l...)
+	}
+
+	seen := map[string]bool{}
+	uniq := []string{}
+	for _, s := range servers {
+		if !seen[s] {
+			seen[s] = true
+			uniq = append(uniq, s)
+		}
+	}
+	if len(uniq) == 0 {
+		return nil, fmt.Errorf("server address must be specified")
+	}
+	return uniq, nil
+}
+
+// readServerFile returns addresses listed in the file one per line. Blank
+// lines and lines starting with '#' are ignored.
+func readServerFile(fn string) ([]string, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open the server list, %v", err)
+	}
+	defer f.Close()
+
+	servers := []string{}
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		l := strings.TrimSpace(s.Text())
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		servers = append(servers, l)
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read the server list, %v", err)
+	}
+	return servers, nil
+}
+
+// listServerTopologies returns names of topologies on each server, and the
+// sorted names of topologies on any of them. Servers which cannot be listed
+// are reported to w and skipped, and an error is returned only when none of
+// the servers can be listed.
+func listServerTopologies(w io.Writer, servers []string,
+	ver string) (map[string][]string, []string, error) {
+	tpls := map[string][]string{}
+	seen := map[string]bool{}
+	names := []string{}
+	var lastErr error
+	for _, s := range servers {
+		l, err := listTopologies(s, ver)
+		if err != nil {
+			fmt.Fprintf(w, "cannot list topologies on %v, %v\n", s, err)
+			lastErr = err
+			continue
+		}
+		tpls[s] = l
+		for _, n := range l {
+			if !seen[n] {
+				seen[n] = true
+				names = append(names, n)
+			}
+		}
+	}
+	if len(tpls) == 0 {
+		return nil, nil, lastErr
+	}
+	sort.Strings(names)
+	return tpls, names, nil
+}
+
+// serverLabel returns the host and the port of the address shown in the
+// SERVER column, or the address itself when it is not a URL.
+func serverLabel(addr string) string {
+	u, err := url.Parse(addr)
+	if err != nil || u.Host == "" {
+		return addr
+	}
+	return u.Host
+}
+
+// tabLabel returns the name of the tab of lh, which is the topology followed
+// by the server when multiple servers are monitored.
+func (ms *MonitoringState) tabLabel(lh *lineHolder) string {
+	if len(ms.servers) > 1 {
+		return lh.topology + "@" + lh.server
+	}
+	return lh.topology
+}
+
+// serverStatus returns the number of connected servers and labels of
+// disconnected ones, or an empty string when there is only one server. A
+// server is disconnected when a stream of any topology on it is.
+func serverStatus(ms *MonitoringState, tabs []*monitorTab) string {
+	if len(ms.servers) <= 1 {
+		return ""
+	}
+	down := []string{}
+	downs := map[string]bool{}
+	for _, t := range tabs {
+		if t.st.connectionError() != nil && !downs[t.lh.server] {
+			downs[t.lh.server] = true
+			down = append(down, t.lh.server)
+		}
+	}
+	msg := fmt.Sprintf("servers: %d/%d connected", len(ms.servers)-len(down),
+		len(ms.servers))
+	if len(down) > 0 {
+		msg += ", down: " + strings.Join(down, " ")
+	}
+	return msg
+}
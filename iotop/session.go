@@ -0,0 +1,132 @@
+package iotop
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const statusSourcePrefix = "iotop_"
+
+// newStatusSourceName returns a name of the node_statuses source unique to
+// the session, like "iotop_<hostname>_<pid>_<random>".
+func newStatusSourceName() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	b := make([]byte, 3)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		// the name is still unique in the host with PID
+		b = []byte{0, 0, 0}
+	}
+	return fmt.Sprintf("%s%s_%d_%s", statusSourcePrefix, sanitizeIdentifier(host),
+		os.Getpid(), hex.EncodeToString(b))
+}
+
+// sanitizeIdentifier replaces characters which cannot be used in BQL
+// identifiers with '_'.
+func sanitizeIdentifier(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' ||
+			r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// parseStatusSourceName returns the hostname and PID of the session which
+// created the node_statuses source. ok is false when the name is not created
+// by newStatusSourceName.
+func parseStatusSourceName(name string) (host string, pid int, ok bool) {
+	if !strings.HasPrefix(name, statusSourcePrefix) {
+		return "", 0, false
+	}
+	parts := strings.Split(strings.TrimPrefix(name, statusSourcePrefix), "_")
+	if len(parts) < 3 {
+		return "", 0, false
+	}
+	pid, err := strconv.Atoi(parts[len(parts)-2])
+	if err != nil {
+		return "", 0, false
+	}
+	return strings.Join(parts[:len(parts)-2], "_"), pid, true
+}
+
+// findStaleStatusSources returns node_statuses sources created by dead
+// sessions on this host. Sources created on other hosts cannot be checked.
+func findStaleStatusSources(req StatusRequester) ([]string, error) {
+	names, err := listSources(req)
+	if err != nil {
+		return nil, err
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("cannot get the hostname, %v", err)
+	}
+	return staleStatusSources(names, sanitizeIdentifier(host), os.Getpid(),
+		processExists), nil
+}
+
+// staleStatusSources returns names of sources created by sessions on the host
+// whose processes do not exist, except the session of the PID self.
+func staleStatusSources(names []string, host string, self int,
+	exists func(pid int) bool) []string {
+	stale := []string{}
+	for _, name := range names {
+		h, pid, ok := parseStatusSourceName(name)
+		if !ok || h != host || pid == self {
+			continue
+		}
+		if !exists(pid) {
+			stale = append(stale, name)
+		}
+	}
+	return stale
+}
+
+// cleanUpStaleStatusSources reports node_statuses sources left by dead
+// sessions to w, and drops them when drop is true. It is best-effort, and
+// failures are also reported to w not to stop monitoring.
+func cleanUpStaleStatusSources(w io.Writer, req StatusRequester, drop bool) {
+	stale, err := findStaleStatusSources(req)
+	if err != nil {
+		fmt.Fprintf(w, "cannot check sources left by dead iotop sessions, %v\n",
+			err)
+		return
+	}
+	for _, name := range stale {
+		if !drop {
+			fmt.Fprintf(w, "source '%v' seems to be left by a dead iotop session, "+
+				"use --gc-sources to drop it\n", name)
+			continue
+		}
+		if err := tearDownStatusQuery(req, name); err != nil {
+			fmt.Fprintf(w, "cannot drop a stale source '%v', %v\n", name, err)
+			continue
+		}
+		fmt.Fprintf(w, "dropped a stale source '%v'\n", name)
+	}
+}
+
+func processExists(pid int) bool {
+	if runtime.GOOS == "windows" {
+		// signal 0 is not supported, regard the process as alive not to drop
+		// sources in use.
+		return true
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = p.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,66 @@
+package iotop
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseStatusSourceName(t *testing.T) {
+	cases := []struct {
+		name string
+		host string
+		pid  int
+		ok   bool
+	}{
+		{"iotop_myhost_123_a1b2c3", "myhost", 123, true},
+		{"iotop_my_host_local_123_a1b2c3", "my_host_local", 123, true},
+		{"iotop__123_a1b2c3", "", 123, true},
+		{"iotop_myhost_abc_a1b2c3", "", 0, false},
+		{"iotop_123_a1b2c3", "", 0, false},
+		{"iotop_", "", 0, false},
+		{"node_statuses", "", 0, false},
+		{"myhost_123_a1b2c3", "", 0, false},
+	}
+	for _, c := range cases {
+		host, pid, ok := parseStatusSourceName(c.name)
+		if host != c.host || pid != c.pid || ok != c.ok {
+			t.Errorf("%q: got (%q, %d, %v), want (%q, %d, %v)", c.name, host, pid,
+				ok, c.host, c.pid, c.ok)
+		}
+	}
+}
+
+func TestParseStatusSourceNameOfNewName(t *testing.T) {
+	name := newStatusSourceName()
+	if _, _, ok := parseStatusSourceName(name); !ok {
+		t.Errorf("%q cannot be parsed", name)
+	}
+}
+
+func TestStaleStatusSources(t *testing.T) {
+	alive := map[int]bool{100: true, 200: true}
+	exists := func(pid int) bool { return alive[pid] }
+	names := []string{
+		"iotop_myhost_100_aaaaaa",    // live pid
+		"iotop_myhost_300_bbbbbb",    // dead pid
+		"iotop_otherhost_300_cccccc", // foreign host
+		"iotop_myhost_200_dddddd",    // self
+		"iotop_myhost_x_eeeeee",      // malformed
+		"iotop_myhost_400_ffffff",    // dead pid
+		"user_source",
+	}
+	got := staleStatusSources(names, "myhost", 200, exists)
+	want := []string{"iotop_myhost_300_bbbbbb", "iotop_myhost_400_ffffff"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// the session itself is not stale even if the check fails
+	got = staleStatusSources(names, "myhost", 100,
+		func(int) bool { return false })
+	want = []string{"iotop_myhost_300_bbbbbb", "iotop_myhost_200_dddddd",
+		"iotop_myhost_400_ffffff"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,150 @@
+package iotop
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// defaultSmoothWindows are windows of exponentially weighted moving averages
+// of rates, like load average.
+var defaultSmoothWindows = []time.Duration{time.Minute, 5 * time.Minute,
+	15 * time.Minute}
+
+// parseSmoothWindows parses windows separated by commas like "1m,5m,15m".
+func parseSmoothWindows(s string) ([]time.Duration, error) {
+	windows := []time.Duration{}
+	for _, w := range strings.Split(s, ",") {
+		d, err := time.ParseDuration(strings.TrimSpace(w))
+		if err != nil {
+			return nil, fmt.Errorf("invalid window ('%v')", w)
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("window must be positive ('%v')", w)
+		}
+		windows = append(windows, d)
+	}
+	return windows, nil
+}
+
+// addEWMA updates exponentially weighted moving averages of rates for each
+// window with the rate over the elapsed seconds. The first rate initializes
+// all of them.
+func (r *rateHistory) addEWMA(v, elapsed float64, windows []time.Duration) {
+	if len(r.ewma) != len(windows) {
+		r.ewma = make([]float64, len(windows))
+		for i := range r.ewma {
+			r.ewma[i] = v
+		}
+		return
+	}
+	for i, w := range windows {
+		a := 1 - math.Exp(-elapsed/w.Seconds())
+		r.ewma[i] += a * (v - r.ewma[i])
+	}
+}
+
+// mean returns the moving average of rates kept in the history.
+func (r *rateHistory) mean() float64 {
+	sum := 0.
+	l := r.list()
+	for _, v := range l {
+		sum += v
+	}
+	return sum / float64(len(l))
+}
+
+// smoothStatus returns a message in the smoothed view, or an empty string.
+func smoothStatus(ms *MonitoringState) string {
+	if !ms.smoothed {
+		return ""
+	}
+	return fmt.Sprintf("smoothed rates (%v EWMA, s to go back)",
+		shortDuration(ms.smoothWindows[0]))
+}
+
+// rateHeader returns the header of the rate column of node tables, which is
+// suffixed with the first window in the smoothed view.
+func rateHeader(name string, ms *MonitoringState) string {
+	if !ms.smoothed {
+		return name
+	}
+	return name + "~" + strings.ToUpper(shortDuration(ms.smoothWindows[0]))
+}
+
+// displayedRate returns the rate shown in the rate column of node tables,
+// which is swapped for the EWMA of the first window in the smoothed view.
+// The EWMA is missing until the first rate is recorded to the history.
+func displayedRate(rate float64, hist *rateHistory, ms *MonitoringState) string {
+	if !ms.smoothed {
+		return fmt.Sprintf("%.2f", rate)
+	}
+	if hist == nil || len(hist.ewma) == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f", hist.ewma[0])
+}
+
+// avgHeader returns the header of the moving average of the rates in the
+// history, with the time span of the history at the current interval.
+func avgHeader(ms *MonitoringState) string {
+	return fmt.Sprintf("AVG(%v)", shortDuration(rateHistoryLength*ms.d))
+}
+
+// smoothedHeader returns headers of columns of smoothed rates, which are
+// empty when they are not shown. The first window is omitted when it is
+// shown in the rate column.
+func smoothedHeader(ms *MonitoringState, inRateColumn bool) string {
+	if !ms.smoothed {
+		return ""
+	}
+	hs := []string{avgHeader(ms)}
+	for i, w := range ms.smoothWindows {
+		if i == 0 && inRateColumn {
+			continue
+		}
+		hs = append(hs, strings.ToUpper(shortDuration(w)))
+	}
+	return "\t" + strings.Join(hs, "\t")
+}
+
+// smoothedColumns returns the moving average of the rates in the history and
+// their exponentially weighted moving averages for each window. The first
+// window is omitted when it is shown in the rate column.
+func smoothedColumns(hist *rateHistory, ms *MonitoringState,
+	inRateColumn bool) string {
+	if !ms.smoothed {
+		return ""
+	}
+	windows := len(ms.smoothWindows)
+	first := 0
+	if inRateColumn {
+		first = 1
+	}
+	if hist == nil || hist.n == 0 {
+		return strings.Repeat("\t-", windows-first+1)
+	}
+	cols := []string{fmt.Sprintf("%.2f", hist.mean())}
+	for i := first; i < windows; i++ {
+		if i < len(hist.ewma) {
+			cols = append(cols, fmt.Sprintf("%.2f", hist.ewma[i]))
+		} else {
+			cols = append(cols, "-")
+		}
+	}
+	return "\t" + strings.Join(cols, "\t")
+}
+
+// shortDuration returns the duration like "1m" or "30s" without zero units.
+func shortDuration(d time.Duration) string {
+	switch {
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	case d%time.Second == 0:
+		return fmt.Sprintf("%ds", d/time.Second)
+	}
+	return d.String()
+}
@@ -0,0 +1,207 @@
+package iotop
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// sortColumn is a column to sort lines of each table. Tables which do not
+// have the column are sorted by name.
+type sortColumn int
+
+const (
+	sortByName sortColumn = iota
+	sortByRate
+	sortByDropped
+	sortByErrors
+	sortByQueue
+)
+
+var sortColumnNames = []string{"name", "rate", "dropped", "errors", "queue"}
+
+func (c sortColumn) String() string {
+	return sortColumnNames[c]
+}
+
+func parseSortColumn(name string) (sortColumn, error) {
+	for i, n := range sortColumnNames {
+		if n == name {
+			return sortColumn(i), nil
+		}
+	}
+	return sortByName, fmt.Errorf("invalid sort column ('%v'), must be one of %v",
+		name, strings.Join(sortColumnNames, ", "))
+}
+
+// next returns the next column to sort, or the previous one when d is -1.
+func (c sortColumn) next(d int) sortColumn {
+	n := len(sortColumnNames)
+	return sortColumn(((int(c)+d)%n + n) % n)
+}
+
+// sortStatus returns a message of the current sort order, or an empty string
+// when sorted by name in ascending order.
+func sortStatus(ms *MonitoringState) string {
+	if ms.sortColumn == sortByName && !ms.sortReverse {
+		return ""
+	}
+	order := "descending"
+	if (ms.sortColumn == sortByName) != ms.sortReverse {
+		order = "ascending"
+	}
+	return fmt.Sprintf("sort by %v, %v", ms.sortColumn, order)
+}
+
+// sortLineKeys sorts keys, which are already sorted by name, by the column of
+// MonitoringState. Names are sorted in ascending order and other columns are
+// sorted in descending order, and they are reversed by ms.sortReverse. value
+// returns the value of the column, and false when the table does not have it.
+// Unknown values are NaN, and sorted last in both orders.
+func sortLineKeys(keys []string, ms *MonitoringState,
+	value func(key string, c sortColumn) (float64, bool)) []string {
+	if len(keys) == 0 {
+		return keys
+	}
+	c := ms.sortColumn
+	if _, ok := value(keys[0], c); !ok {
+		c = sortByName
+	}
+	if c == sortByName {
+		if ms.sortReverse {
+			for i, j := 0, len(keys)-1; i < j; i, j = i+1, j-1 {
+				keys[i], keys[j] = keys[j], keys[i]
+			}
+		}
+		return keys
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		vi, _ := value(keys[i], c)
+		vj, _ := value(keys[j], c)
+		if ni, nj := math.IsNaN(vi), math.IsNaN(vj); ni || nj {
+			return !ni && nj
+		}
+		if ms.sortReverse {
+			return vi < vj
+		}
+		return vi > vj
+	})
+	return keys
+}
+
+// rateValue returns a rate shown in tables, the absolute value when rates are
+// not shown, or NaN when the rate is unknown without the previous status.
+func (h *lineHolder) rateValue(cur, prev int64, hasPrev bool,
+	ms *MonitoringState) float64 {
+	switch {
+	case ms.absFlag:
+		return float64(cur)
+	case !hasPrev:
+		return math.NaN()
+	}
+	return h.rate(cur-prev, ms)
+}
+
+// nodeRateValue returns the value of the rate column of the node, which is the
+// EWMA of the first window in the smoothed view.
+func (h *lineHolder) nodeRateValue(name string, cur, prev int64, hasPrev bool,
+	ms *MonitoringState) float64 {
+	if !ms.smoothed || ms.absFlag || !hasPrev {
+		return h.rateValue(cur, prev, hasPrev, ms)
+	}
+	hist := h.history[name]
+	if hist == nil || len(hist.ewma) == 0 {
+		return math.NaN()
+	}
+	return hist.ewma[0]
+}
+
+func (h *lineHolder) sortedSourceKeys(ms *MonitoringState) []string {
+	keys := ms.filter.filterKeys(sourceLineMap(h.srcs).sortedKeys(),
+		func(key string) bool { return ms.filter.match(h.srcs[key].name) })
+	return sortLineKeys(keys, ms,
+		func(key string, c sortColumn) (float64, bool) {
+			l := h.srcs[key]
+			switch c {
+			case sortByRate:
+				prev, ok := h.prev.srcs[key]
+				return h.nodeRateValue(key, l.out, prev.out, ok, ms), true
+			case sortByDropped:
+				return float64(l.dropped), true
+			}
+			return 0, false
+		})
+}
+
+func (h *lineHolder) sortedBoxKeys(ms *MonitoringState) []string {
+	keys := ms.filter.filterKeys(boxLineMap(h.boxes).sortedKeys(),
+		func(key string) bool { return ms.filter.match(h.boxes[key].name) })
+	return sortLineKeys(keys, ms,
+		func(key string, c sortColumn) (float64, bool) {
+			l := h.boxes[key]
+			switch c {
+			case sortByRate:
+				prev, ok := h.prev.boxes[key]
+				return h.nodeRateValue(key, l.inOut, prev.inOut, ok, ms), true
+			case sortByDropped:
+				return float64(l.dropped), true
+			case sortByErrors:
+				return float64(l.nerror), true
+			}
+			return 0, false
+		})
+}
+
+func (h *lineHolder) sortedSinkKeys(ms *MonitoringState) []string {
+	keys := ms.filter.filterKeys(sinkLineMap(h.sinks).sortedKeys(),
+		func(key string) bool { return ms.filter.match(h.sinks[key].name) })
+	return sortLineKeys(keys, ms,
+		func(key string, c sortColumn) (float64, bool) {
+			l := h.sinks[key]
+			switch c {
+			case sortByRate:
+				prev, ok := h.prev.sinks[key]
+				return h.nodeRateValue(key, l.in, prev.in, ok, ms), true
+			case sortByErrors:
+				return float64(l.nerror), true
+			}
+			return 0, false
+		})
+}
+
+func (h *lineHolder) sortedEdgeKeys(ms *MonitoringState) []string {
+	keys := ms.filter.filterKeys(edgeLineMap(h.edges).sortedKeys(),
+		func(key string) bool { return ms.filter.matchEdge(h.edges[key]) })
+	return sortLineKeys(keys, ms,
+		func(key string, c sortColumn) (float64, bool) {
+			l := h.edges[key]
+			switch c {
+			case sortByRate:
+				var prevInOut int64
+				prev, ok := h.prev.edges[key]
+				if ok {
+					prevInOut = prev.inOut
+				}
+				return h.rateValue(l.inOut, prevInOut, ok, ms), true
+			case sortByQueue:
+				return l.queueFill(), true
+			}
+			return 0, false
+		})
+}
+
+// queueFill returns the larger ratio of queued tuples to the queue size of
+// the sender and the receiver.
+func (l *edgeLine) queueFill() float64 {
+	fill := 0.
+	if l.senderQueueSize > 0 {
+		fill = float64(l.senderQueued) / float64(l.senderQueueSize)
+	}
+	if l.receiverQueueSize > 0 {
+		if f := float64(l.receiverQueued) / float64(l.receiverQueueSize); f > fill {
+			fill = f
+		}
+	}
+	return fill
+}
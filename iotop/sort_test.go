@@ -0,0 +1,77 @@
+package iotop
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSortLineKeys(t *testing.T) {
+	values := map[string]float64{
+		"a": 1, "b": math.NaN(), "c": 3, "d": 2,
+	}
+	value := func(key string, c sortColumn) (float64, bool) {
+		if c != sortByRate {
+			return 0, false
+		}
+		return values[key], true
+	}
+	cases := []struct {
+		column  sortColumn
+		reverse bool
+		want    []string
+	}{
+		{sortByName, false, []string{"a", "b", "c", "d"}},
+		{sortByName, true, []string{"d", "c", "b", "a"}},
+		{sortByRate, false, []string{"c", "d", "a", "b"}},
+		{sortByRate, true, []string{"a", "d", "c", "b"}},
+		// the table does not have the column
+		{sortByQueue, false, []string{"a", "b", "c", "d"}},
+	}
+	for _, c := range cases {
+		ms := &MonitoringState{sortColumn: c.column, sortReverse: c.reverse}
+		got := sortLineKeys([]string{"a", "b", "c", "d"}, ms, value)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%v reverse %v: got %q, want %q", c.column, c.reverse, got,
+				c.want)
+		}
+	}
+}
+
+func TestSortedBoxKeysByRate(t *testing.T) {
+	h := newLineHolder()
+	h.current = time.Unix(10, 0)
+	h.prev.current = time.Unix(5, 0)
+	box := func(name string, inOut int64) boxLine {
+		return boxLine{generalLine: &generalLine{name: name, nodeType: "box",
+			state: "running"}, inOut: inOut}
+	}
+	// new has the largest count but its rate is unknown
+	h.boxes["new"] = box("new", 1000)
+	h.boxes["hot"] = box("hot", 500)
+	h.prev.boxes["hot"] = box("hot", 0)
+	h.boxes["cold"] = box("cold", 100)
+	h.prev.boxes["cold"] = box("cold", 0)
+	// EWMAs are the reverse of the current rates
+	h.history["hot"] = &rateHistory{ewma: []float64{1}}
+	h.history["cold"] = &rateHistory{ewma: []float64{50}}
+
+	cases := []struct {
+		title    string
+		absFlag  bool
+		smoothed bool
+		want     []string
+	}{
+		{"rate", false, false, []string{"hot", "cold", "new"}},
+		{"count", true, false, []string{"new", "hot", "cold"}},
+		{"smoothed", false, true, []string{"cold", "hot", "new"}},
+	}
+	for _, c := range cases {
+		ms := &MonitoringState{d: 5 * time.Second, sortColumn: sortByRate,
+			absFlag: c.absFlag, smoothed: c.smoothed}
+		if got := h.sortedBoxKeys(ms); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%v: got %q, want %q", c.title, got, c.want)
+		}
+	}
+}
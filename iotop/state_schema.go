@@ -44,6 +44,7 @@ type generalLine struct {
 	name     string
 	nodeType string
 	state    string
+	raw      data.Map // all fields of the node status
 }
 
 type sourceLineMap map[string]sourceLine
@@ -83,6 +84,8 @@ func (lm boxLineMap) sortedKeys() []string {
 type boxLine struct {
 	*generalLine
 	processingTime int
+	in             int64
+	out            int64
 	inOut          int64
 	dropped        int64
 	nerror         int64
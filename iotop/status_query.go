@@ -2,6 +2,7 @@ package iotop
 
 import (
 	"fmt"
+	"sort"
 
 	"gopkg.in/sensorbee/sensorbee.v0/client"
 )
@@ -9,11 +10,16 @@ import (
 // StatusRequester is an interface for streaming node status.
 type StatusRequester interface {
 	PostQuery(string) (*client.Response, error)
+	GetSources() (*client.Response, error)
+	Topology() string
+	Server() string
 }
 
 type nodeStatusRequester struct {
 	req  *client.Requester
+	addr string
 	path string
+	tpl  string
 }
 
 func newNodeStatusRequester(addr, ver, tpl string) (StatusRequester, error) {
@@ -25,7 +31,9 @@ func newNodeStatusRequester(addr, ver, tpl string) (StatusRequester, error) {
 	path := "/topologies/" + tpl + "/queries"
 	return &nodeStatusRequester{
 		req:  req,
+		addr: addr,
 		path: path,
+		tpl:  tpl,
 	}, nil
 }
 
@@ -35,9 +43,51 @@ func (n *nodeStatusRequester) PostQuery(bql string) (*client.Response, error) {
 	})
 }
 
-func setupStatusQuery(req StatusRequester, interval float64) error {
+func (n *nodeStatusRequester) GetSources() (*client.Response, error) {
+	return n.req.Do(client.Get, "/topologies/"+n.tpl+"/sources", nil)
+}
+
+func (n *nodeStatusRequester) Topology() string {
+	return n.tpl
+}
+
+func (n *nodeStatusRequester) Server() string {
+	return n.addr
+}
+
+// listTopologies returns names of all topologies on the server.
+func listTopologies(addr, ver string) ([]string, error) {
+	req, err := client.NewRequester(addr, ver)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create a new requester, %v", err)
+	}
+	res, err := req.Do(client.Get, "/topologies", nil)
+	if err != nil {
+		return nil, fmt.Errorf("request failed to list topologies, %v", err)
+	}
+	defer res.Close()
+	if err := checkResponseError(res); err != nil {
+		return nil, err
+	}
+	js := struct {
+		Topologies []struct {
+			Name string `json:"name"`
+		} `json:"topologies"`
+	}{}
+	if err := res.ReadJSON(&js); err != nil {
+		return nil, fmt.Errorf("cannot read the list of topologies, %v", err)
+	}
+	names := make([]string, len(js.Topologies))
+	for i, t := range js.Topologies {
+		names[i] = t.Name
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func setupStatusQuery(req StatusRequester, name string, interval float64) error {
 	createNodeStatusSourceBQL := fmt.Sprintf(
-		`CREATE SOURCE iotop_ns TYPE node_statuses WITH interval = %f;`, interval)
+		`CREATE SOURCE %s TYPE node_statuses WITH interval = %f;`, name, interval)
 	res, err := req.PostQuery(createNodeStatusSourceBQL)
 	if err != nil {
 		return fmt.Errorf("request failed to create 'node_statuses' source, %v", err)
@@ -49,8 +99,9 @@ func setupStatusQuery(req StatusRequester, interval float64) error {
 	return nil
 }
 
-func selectNodeStatus(req StatusRequester) (res *client.Response, err error) {
-	selectNodeStatusBQL := `SELECT RSTREAM *, ts() FROM iotop_ns [RANGE 1 TUPLES];`
+func selectNodeStatus(req StatusRequester, name string) (res *client.Response, err error) {
+	selectNodeStatusBQL := fmt.Sprintf(
+		`SELECT RSTREAM *, ts() FROM %s [RANGE 1 TUPLES];`, name)
 	res, err = req.PostQuery(selectNodeStatusBQL)
 	if err != nil {
 		return nil, fmt.Errorf("request failed to stream 'node_statuses', %v", err)
@@ -70,9 +121,38 @@ func selectNodeStatus(req StatusRequester) (res *client.Response, err error) {
 	return
 }
 
-func tearDownStatusQuery(req StatusRequester) error {
-	_, err := req.PostQuery(`DROP SOURCE iotop_ns;`)
-	return err
+func tearDownStatusQuery(req StatusRequester, name string) error {
+	res, err := req.PostQuery(fmt.Sprintf(`DROP SOURCE %s;`, name))
+	if err != nil {
+		return fmt.Errorf("request failed to drop the source, %v", err)
+	}
+	defer res.Close()
+	return checkResponseError(res)
+}
+
+// listSources returns names of all sources in the topology.
+func listSources(req StatusRequester) ([]string, error) {
+	res, err := req.GetSources()
+	if err != nil {
+		return nil, fmt.Errorf("request failed to list sources, %v", err)
+	}
+	defer res.Close()
+	if err := checkResponseError(res); err != nil {
+		return nil, err
+	}
+	js := struct {
+		Sources []struct {
+			Name string `json:"name"`
+		} `json:"sources"`
+	}{}
+	if err := res.ReadJSON(&js); err != nil {
+		return nil, fmt.Errorf("cannot read the list of sources, %v", err)
+	}
+	names := make([]string, len(js.Sources))
+	for i, s := range js.Sources {
+		names[i] = s.Name
+	}
+	return names, nil
 }
 
 func checkResponseError(res *client.Response) error {
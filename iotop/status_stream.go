@@ -0,0 +1,301 @@
+package iotop
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"gopkg.in/sensorbee/sensorbee.v0/client"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+)
+
+const (
+	reconnectMinWait = time.Second
+	reconnectMaxWait = 30 * time.Second
+)
+
+// nodeStatusStream pushes node statuses streamed from the server to
+// lineHolder, and records them when the recorder is set. The stream can be
+// restarted to change the interval of the node_statuses source, which is
+// named uniquely to the session. When the stream is closed, it reconnects to
+// the server with backoff, and lineHolder keeps the last statuses until then.
+type nodeStatusStream struct {
+	req     StatusRequester
+	name    string
+	lh      *lineHolder
+	rec     *statusRecorder
+	errChan chan error
+
+	cm sync.Mutex // serializes creating and dropping the source
+
+	m        sync.Mutex
+	res      *client.Response
+	gen      int // changed on each connection, stop and restart
+	interval float64
+	connErr  error // the last error while disconnected
+}
+
+func newNodeStatusStream(req StatusRequester, lh *lineHolder,
+	rec *statusRecorder) *nodeStatusStream {
+	return &nodeStatusStream{
+		req:     req,
+		name:    newStatusSourceName(),
+		lh:      lh,
+		rec:     rec,
+		errChan: make(chan error, 1),
+	}
+}
+
+// start creates the node_statuses source with the interval [sec] and starts
+// reading statuses in background. An error is sent to errChan when a status
+// cannot be read.
+func (s *nodeStatusStream) start(interval float64) error {
+	s.cm.Lock()
+	defer s.cm.Unlock()
+	s.m.Lock()
+	s.interval = interval
+	s.m.Unlock()
+	return s.connect()
+}
+
+// connect creates the source and starts reading. s.cm must be locked.
+func (s *nodeStatusStream) connect() error {
+	s.m.Lock()
+	interval := s.interval
+	s.m.Unlock()
+
+	if err := setupStatusQuery(s.req, s.name, interval); err != nil {
+		return err
+	}
+	res, err := selectNodeStatus(s.req, s.name)
+	if err != nil {
+		tearDownStatusQuery(s.req, s.name)
+		return err
+	}
+	ch, err := res.ReadStreamJSON()
+	if err != nil {
+		res.Close()
+		tearDownStatusQuery(s.req, s.name)
+		return err
+	}
+
+	s.m.Lock()
+	s.res = res
+	s.gen++
+	gen := s.gen
+	s.connErr = nil
+	s.m.Unlock()
+	go s.read(ch, gen)
+	return nil
+}
+
+func (s *nodeStatusStream) read(ch <-chan interface{}, gen int) {
+	defer s.stopOnPanic()
+	for {
+		iv, ok := <-ch
+		if !ok || iv == nil {
+			s.reconnect(gen, errors.New("monitoring stream is closed"))
+			return
+		}
+		if s.rec != nil {
+			if err := s.rec.record(iv); err != nil {
+				s.fail(gen, err)
+				return
+			}
+		}
+		v, err := data.NewValue(iv)
+		if err != nil {
+			s.fail(gen, err)
+			return
+		}
+		m, err := data.AsMap(v)
+		if err != nil {
+			s.fail(gen, err)
+			return
+		}
+		if err := s.lh.push(m); err != nil {
+			s.fail(gen, err)
+			return
+		}
+	}
+}
+
+// fail sends the error to errChan unless the stream of gen has been already
+// stopped or restarted.
+func (s *nodeStatusStream) fail(gen int, err error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.gen != gen {
+		return
+	}
+	select {
+	case s.errChan <- err:
+	default:
+	}
+}
+
+// reconnect closes the stream of gen disconnected by the error, and retries
+// connecting in background.
+func (s *nodeStatusStream) reconnect(gen int, err error) {
+	s.cm.Lock()
+	s.m.Lock()
+	if s.gen != gen {
+		s.m.Unlock()
+		s.cm.Unlock()
+		return
+	}
+	res := s.res
+	s.res = nil
+	s.connErr = err
+	s.m.Unlock()
+	if res != nil {
+		res.Close()
+		// the source remains when only the stream is closed
+		tearDownStatusQuery(s.req, s.name)
+	}
+	s.cm.Unlock()
+	s.retry(gen)
+}
+
+// retry connects with exponential backoff until it succeeds, or the stream of
+// gen is stopped or restarted.
+func (s *nodeStatusStream) retry(gen int) {
+	for wait := reconnectMinWait; ; wait *= 2 {
+		if wait > reconnectMaxWait {
+			wait = reconnectMaxWait
+		}
+		time.Sleep(wait)
+
+		s.cm.Lock()
+		s.m.Lock()
+		stale := s.gen != gen
+		s.m.Unlock()
+		if stale {
+			s.cm.Unlock()
+			return
+		}
+		err := s.connect()
+		if err != nil {
+			s.m.Lock()
+			s.connErr = err
+			s.m.Unlock()
+		}
+		s.cm.Unlock()
+		if err == nil {
+			return
+		}
+	}
+}
+
+// connectionError returns the last error while the stream is disconnected, or
+// nil when it is connected.
+func (s *nodeStatusStream) connectionError() error {
+	if s == nil {
+		return nil
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.connErr
+}
+
+// stop closes the stream and drops the node_statuses source. It returns the
+// error of dropping the source, which is left on the server then, and can be
+// ignored when the source is recreated with the same name.
+func (s *nodeStatusStream) stop() error {
+	s.cm.Lock()
+	defer s.cm.Unlock()
+	s.m.Lock()
+	res := s.res
+	s.res = nil
+	s.gen++
+	s.connErr = nil
+	s.m.Unlock()
+	if res == nil {
+		return nil
+	}
+	res.Close()
+	return tearDownStatusQuery(s.req, s.name)
+}
+
+// stopOnPanic drops the source and panics again. It is deferred in each
+// goroutine of monitoring, because a panic in another goroutine does not run
+// functions deferred in Monitor.
+func (s *nodeStatusStream) stopOnPanic() {
+	if s == nil {
+		return
+	}
+	if r := recover(); r != nil {
+		s.stop()
+		panic(r)
+	}
+}
+
+// errorsOrSignal returns a channel which receives an error from errChan, or
+// nil on SIGINT or SIGTERM to stop monitoring normally.
+func (s *nodeStatusStream) errorsOrSignal() <-chan error {
+	return streamsErrorsOrSignal(s)
+}
+
+// streamsErrorsOrSignal returns a channel which receives the first error from
+// errChan of the streams, or nil on SIGINT or SIGTERM.
+func streamsErrorsOrSignal(sts ...*nodeStatusStream) <-chan error {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	errChan := make(chan error, 1)
+	done := make(chan struct{})
+	for _, s := range sts {
+		go func(s *nodeStatusStream) {
+			select {
+			case err := <-s.errChan:
+				select {
+				case errChan <- err:
+				default:
+				}
+			case <-done:
+			}
+		}(s)
+	}
+	ch := make(chan error, 1)
+	go func() {
+		defer signal.Stop(sigChan)
+		defer close(done)
+		select {
+		case err := <-errChan:
+			ch <- err
+		case <-sigChan:
+			ch <- nil
+		}
+	}()
+	return ch
+}
+
+// restart recreates the node_statuses source with the new interval [sec].
+// When the source cannot be created, it retries in background as well as
+// reconnection.
+func (s *nodeStatusStream) restart(interval float64) {
+	s.stop()
+	s.startOrRetry(interval)
+}
+
+// startOrRetry starts the stream as well as start, but when the source cannot
+// be created, the stream is regarded as disconnected by the error, and
+// retries in background as well as reconnection.
+func (s *nodeStatusStream) startOrRetry(interval float64) error {
+	s.cm.Lock()
+	defer s.cm.Unlock()
+	s.m.Lock()
+	s.interval = interval
+	s.m.Unlock()
+	err := s.connect()
+	if err != nil {
+		s.m.Lock()
+		s.connErr = err
+		gen := s.gen
+		s.m.Unlock()
+		go s.retry(gen)
+	}
+	return err
+}
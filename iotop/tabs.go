@@ -0,0 +1,79 @@
+package iotop
+
+import (
+	"fmt"
+	"strings"
+)
+
+// monitorTab is a topology on a server monitored in the session, which is
+// shown in a tab of terminal UI.
+type monitorTab struct {
+	lh *lineHolder
+	st *nodeStatusStream // nil on replay
+}
+
+// tabTopologies returns names of topologies of tabs in the order of tabs,
+// which can be changed by switching topologies.
+func tabTopologies(tabs []*monitorTab) []string {
+	seen := map[string]bool{}
+	tpls := []string{}
+	for _, t := range tabs {
+		if !seen[t.lh.topology] {
+			seen[t.lh.topology] = true
+			tpls = append(tpls, t.lh.topology)
+		}
+	}
+	return tpls
+}
+
+// currentTab returns the tab shown in terminal UI.
+func (ms *MonitoringState) currentTab(tabs []*monitorTab) *monitorTab {
+	if ms.tab >= len(tabs) {
+		ms.tab = 0
+	}
+	return tabs[ms.tab]
+}
+
+// switchTab shows the next tab, or the previous one when d is -1.
+func (ms *MonitoringState) switchTab(tabs []*monitorTab, d int) {
+	n := len(tabs)
+	ms.tab = ((ms.tab+d)%n + n) % n
+	ms.tableScroll = scrollState{}
+	ms.graphScroll = scrollState{}
+	ms.fleetScroll = scrollState{}
+	ms.detailNode = ""
+}
+
+// tabStatus returns names of topologies with the current one in brackets,
+// and disconnected ones marked with '!', or an empty string when there is
+// only one topology.
+func tabStatus(ms *MonitoringState, tabs []*monitorTab) string {
+	if len(tabs) <= 1 {
+		return ""
+	}
+	names := make([]string, len(tabs))
+	for i, t := range tabs {
+		name := ms.tabLabel(t.lh)
+		if t.st.connectionError() != nil {
+			name += "!"
+		}
+		if i == ms.tab {
+			name = "[" + name + "]"
+		}
+		names[i] = name
+	}
+	return fmt.Sprintf("topology: %v (Tab to switch)", strings.Join(names, " "))
+}
+
+// stopTabsOnPanic stops streams of all tabs and panics again, see
+// nodeStatusStream.stopOnPanic.
+func stopTabsOnPanic(tabs []*monitorTab) {
+	if r := recover(); r != nil {
+		for _, t := range tabs {
+			if t.st != nil {
+				t.st.stop()
+			}
+		}
+		panic(r)
+	}
+}
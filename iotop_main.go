@@ -16,6 +16,7 @@ func main() {
 	app.Version = "0.0.1"
 	app.Flags = cmd.CmdFlags
 	app.Action = iotop.Run
+	app.Commands = []cli.Command{cmd.SetUpExport()}
 
 	app.Run(os.Args)
 }